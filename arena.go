@@ -0,0 +1,196 @@
+package sortedset
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+const (
+	minSlabSize = 4 << 10
+	maxSlabSize = 1 << 20
+)
+
+// arena keep key bytes in append-only slabs. Written bytes are never
+// modified, so keys may be returned as strings pointing into slab
+type arena struct {
+	slabs [][]byte
+	live  int
+	dead  int
+}
+
+// keyRef is a key position in arena, it contains no pointers
+type keyRef struct {
+	slab uint32
+	off  uint32
+	len  uint32
+}
+
+// alloc copy key into arena
+func (a *arena) alloc(key string) keyRef {
+	if len(key) == 0 {
+		return keyRef{}
+	}
+	last := len(a.slabs) - 1
+	if last < 0 || cap(a.slabs[last])-len(a.slabs[last]) < len(key) {
+		size := minSlabSize
+		if last >= 0 {
+			size = cap(a.slabs[last]) * 2
+		}
+		// last slab may be sealed by fork with a few bytes
+		if size < minSlabSize {
+			size = minSlabSize
+		}
+		if size > maxSlabSize {
+			size = maxSlabSize
+		}
+		if size < len(key) {
+			size = len(key)
+		}
+		a.slabs = append(a.slabs, make([]byte, 0, size))
+		last++
+	}
+	off := len(a.slabs[last])
+	a.slabs[last] = append(a.slabs[last], key...)
+	a.live += len(key)
+	return keyRef{slab: uint32(last), off: uint32(off), len: uint32(len(key))}
+}
+
+// fork return arena with the same keys. If seal, last slab is sealed and
+// forked arena allocate new slabs, else it append to free space of last
+// slab, which is not used by other forks. Only one fork may be unsealed
+func (a *arena) fork(seal bool) *arena {
+	f := &arena{slabs: make([][]byte, len(a.slabs)), live: a.live, dead: a.dead}
+	copy(f.slabs, a.slabs)
+	if seal {
+		for i, slab := range f.slabs {
+			f.slabs[i] = slab[:len(slab):len(slab)]
+		}
+	}
+	return f
+}
+
+// get return key without copy
+func (a *arena) get(ref keyRef) string {
+	if ref.len == 0 {
+		return ""
+	}
+	return unsafe.String(&a.slabs[ref.slab][ref.off], ref.len)
+}
+
+// free mark key bytes as dead
+func (a *arena) free(ref keyRef) {
+	a.live -= int(ref.len)
+	a.dead += int(ref.len)
+}
+
+// needCompact report whether dead bytes take more space than live
+func (a *arena) needCompact() bool {
+	return a.dead > minSlabSize && a.dead > a.live
+}
+
+// compact copy live keys into new slabs. Old slabs are released by GC
+// when there are no more strings pointing into them
+func (set *SortedSet) compact() {
+	a := set.arena
+	old := *a
+	*a = arena{}
+	for i := range set.pages {
+		p := set.own(i)
+		s := p.keys.(*arenaStore)
+		for i := 0; i < p.numItems; i++ {
+			s.refs[i] = a.alloc(old.get(s.refs[i]))
+		}
+		if p.numItems > 0 {
+			p.max = p.key(0)
+			p.min = p.key(p.numItems - 1)
+		}
+	}
+}
+
+// Compact release memory of deleted keys, it's done automatically
+// after deletes. Only StorageArena sets need compaction
+func (set *SortedSet) Compact() {
+	set.Lock()
+	defer set.Unlock()
+	if set.arena != nil {
+		set.compact()
+	}
+}
+
+func (set *SortedSet) checkArena() error {
+	a := set.arena
+	live := 0
+	for i, p := range set.pages {
+		s, ok := p.keys.(*arenaStore)
+		// shared pages read arena of set before clone
+		if !ok || (p.gen == set.gen && s.arena != a) {
+			return fmt.Errorf("sortedset: page %d is not in set arena", i)
+		}
+		for j := 0; j < p.numItems; j++ {
+			live += int(s.refs[j].len)
+		}
+	}
+	if live != a.live {
+		return fmt.Errorf("sortedset: arena live bytes %d, pages hold %d", a.live, live)
+	}
+	return nil
+}
+
+// arenaStore keep references to keys in arena.
+// refs contain no pointers, so GC do not scan them
+type arenaStore struct {
+	arena *arena
+	refs  []keyRef
+}
+
+func (s *arenaStore) key(i int) string {
+	return s.arena.get(s.refs[i])
+}
+
+func (s *arenaStore) insert(n, i int, key string) {
+	copy(s.refs[i+1:n+1], s.refs[i:n])
+	s.refs[i] = s.arena.alloc(key)
+}
+
+func (s *arenaStore) remove(n, i int) {
+	s.arena.free(s.refs[i])
+	copy(s.refs[i:n], s.refs[i+1:n])
+	s.refs[n-1] = keyRef{}
+}
+
+func (s *arenaStore) split(n, mid int) keyStore {
+	right := &arenaStore{arena: s.arena, refs: make([]keyRef, len(s.refs))}
+	copy(right.refs, s.refs[mid:n])
+	for i := mid; i < n; i++ {
+		s.refs[i] = keyRef{}
+	}
+	return right
+}
+
+func (s *arenaStore) resize(n, size int) {
+	refs := make([]keyRef, size)
+	copy(refs, s.refs[:n])
+	s.refs = refs
+}
+
+func (s *arenaStore) clone() keyStore {
+	return &arenaStore{arena: s.arena, refs: append([]keyRef(nil), s.refs...)}
+}
+
+func (s *arenaStore) check(n, size int) error {
+	if len(s.refs) != size {
+		return fmt.Errorf("%d refs in page of size %d", len(s.refs), size)
+	}
+	for i := 0; i < n; i++ {
+		ref := s.refs[i]
+		if ref.len > 0 && (int(ref.slab) >= len(s.arena.slabs) || int(ref.off)+int(ref.len) > len(s.arena.slabs[ref.slab])) {
+			return fmt.Errorf("item %d is out of arena", i)
+		}
+	}
+	for i := n; i < len(s.refs); i++ {
+		if s.refs[i] != (keyRef{}) {
+			return fmt.Errorf("padding item %d is not empty", i)
+		}
+	}
+	return nil
+}
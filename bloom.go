@@ -0,0 +1,96 @@
+package sortedset
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+)
+
+// bloom is a filter of page keys. Deleted keys stay in filter until
+// rebuild, they only add false positives
+type bloom struct {
+	seed *maphash.Seed
+	bits []uint64
+	k    int
+	dead int // keys deleted since rebuild
+}
+
+// newBloom create filter for size keys with false positive rate fp
+func newBloom(seed *maphash.Seed, size int, fp float64) *bloom {
+	m := math.Ceil(-float64(size) * math.Log(fp) / (math.Ln2 * math.Ln2))
+	words := (int(m) + 63) / 64
+	k := int(math.Round(float64(words*64) / float64(size) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloom{seed: seed, bits: make([]uint64, words), k: k}
+}
+
+// hash return two hashes of key for double hashing and number of bits
+func (b *bloom) hash(key string) (h1, h2, m uint64) {
+	h := maphash.String(*b.seed, key)
+	return h, h>>32 | 1, uint64(len(b.bits) * 64)
+}
+
+func (b *bloom) add(key string) {
+	h1, h2, m := b.hash(key)
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// has return false if key is not in filter
+func (b *bloom) has(key string) bool {
+	h1, h2, m := b.hash(key)
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuild filter of page, for page of new size
+func (set *SortedSet) rebuild(p *page) {
+	if set.opts.bloom == 0 {
+		return
+	}
+	p.filter = newBloom(&set.seed, p.size, set.opts.bloom)
+	for i := 0; i < p.numItems; i++ {
+		p.filter.add(p.key(i))
+	}
+}
+
+// removed from page, filter is rebuilt when a quarter of keys is deleted
+func (set *SortedSet) removed(p *page) {
+	if p.filter == nil {
+		return
+	}
+	p.filter.dead++
+	if p.filter.dead*4 > p.numItems {
+		set.rebuild(p)
+	}
+}
+
+func (set *SortedSet) checkFilter(p *page) error {
+	if set.opts.bloom == 0 {
+		if p.filter != nil {
+			return fmt.Errorf("filter in set without bloom")
+		}
+		return nil
+	}
+	if p.filter == nil {
+		return fmt.Errorf("no filter")
+	}
+	if want := newBloom(&set.seed, p.size, set.opts.bloom); len(want.bits) != len(p.filter.bits) {
+		return fmt.Errorf("filter has %d words, want %d for size %d", len(p.filter.bits), len(want.bits), p.size)
+	}
+	for i := 0; i < p.numItems; i++ {
+		if !p.filter.has(p.key(i)) {
+			return fmt.Errorf("key %q not in filter", p.key(i))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package sortedset
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloom(t *testing.T) {
+	for _, storage := range storages {
+		set := New(WithBloom(0.01), WithPageSize(64), WithStorage(storage.storage))
+		keys := randKeys(5000)
+		for i, key := range keys {
+			set.Put(key)
+			if i%3 == 0 {
+				set.Delete(keys[i/2])
+			}
+		}
+		assert.NoError(t, set.Validate(), storage.name)
+		model := New(WithPageSize(64))
+		for i, key := range keys {
+			model.Put(key)
+			if i%3 == 0 {
+				model.Delete(keys[i/2])
+			}
+		}
+		for _, key := range keys {
+			assert.Equal(t, model.Has(key), set.Has(key))
+		}
+	}
+
+	set := New(WithBloom(0.01), WithPageSize(256))
+	for i := 0; i < 10000; i++ {
+		set.Put(fmt.Sprintf("key%06d", i))
+	}
+	assert.NoError(t, set.Validate())
+	positive := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("miss%06d", i)
+		assert.False(t, set.Has(key))
+		// page which would hold miss key
+		p := set.pages[set.idxPage(key, false)]
+		if p.filter.has(key) {
+			positive++
+		}
+	}
+	assert.True(t, positive < 300, "false positives %d", positive)
+
+	// adaptive pages rebuild filter on resize
+	set = New(WithBloom(0.05), WithPageSize(16), WithAdaptivePages(16, 256))
+	for _, key := range randKeys(3000) {
+		set.Put(key)
+	}
+	assert.NoError(t, set.Validate())
+
+	_, err := NewWithError(WithBloom(0))
+	assert.Error(t, err)
+	_, err = NewWithError(WithBloom(1))
+	assert.Error(t, err)
+}
+
+// miss-heavy workload, like dedup checks
+func BenchmarkHasMiss(b *testing.B) {
+	for _, fp := range []float64{0, 0.01, 0.001} {
+		b.Run(fmt.Sprintf("bloom=%v", fp), func(b *testing.B) {
+			opts := []Option{}
+			if fp > 0 {
+				opts = append(opts, WithBloom(fp))
+			}
+			set := New(opts...)
+			for i := 0; i < 1000000; i++ {
+				set.Put(fmt.Sprintf("event:%012d", i*2))
+			}
+			keys := make([]string, 1<<16)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("event:%012d", i*62+1)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if set.Has(keys[i&(len(keys)-1)]) {
+					b.Fatal("bad news")
+				}
+			}
+		})
+	}
+}
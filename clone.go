@@ -0,0 +1,73 @@
+package sortedset
+
+import "sync/atomic"
+
+// lastGen is a source of unique set generations
+var lastGen atomic.Uint64
+
+func nextGen() uint64 {
+	return lastGen.Add(1)
+}
+
+// Clone return copy of set in O(1). Copy share pages with set, page is
+// copied by the set which change it first, so both sets are independent
+// and safe for concurrent use. Metrics are not cloned, see Instrument
+func (set *SortedSet) Clone() *SortedSet {
+	set.Lock()
+	defer set.Unlock()
+	return set.clone()
+}
+
+func (set *SortedSet) clone() *SortedSet {
+	c := &SortedSet{
+		pages:   set.pages,
+		count:   set.count,
+		opts:    set.opts,
+		seed:    set.seed,
+		gen:     nextGen(),
+		shared:  true,
+		counted: set.counted,
+		maxSize: set.maxSize,
+	}
+	// pages of set are shared now, set copy them on write too
+	set.gen = nextGen()
+	set.shared = true
+	if set.arena != nil {
+		// shared pages keep reading old arena, nobody write to it anymore.
+		// Set keep free space of last slab, clone start new one
+		c.arena = set.arena.fork(true)
+		set.arena = set.arena.fork(false)
+	}
+	return c
+}
+
+// own return page at idx which may be changed by set,
+// shared page and index are copied
+func (set *SortedSet) own(idx int) *page {
+	if set.shared {
+		pages := make([]*page, len(set.pages), cap(set.pages))
+		copy(pages, set.pages)
+		set.pages = pages
+		set.shared = false
+	}
+	p := set.pages[idx]
+	if p.gen == set.gen {
+		return p
+	}
+	c := *p
+	c.gen = set.gen
+	c.keys = p.keys.clone()
+	if s, ok := c.keys.(*arenaStore); ok {
+		s.arena = set.arena
+	}
+	if p.counts != nil {
+		c.counts = append(make([]int, 0, cap(p.counts)), p.counts...)
+	}
+	if p.filter != nil {
+		f := *p.filter
+		f.bits = append([]uint64(nil), p.filter.bits...)
+		c.filter = &f
+	}
+	set.pages[idx] = &c
+	return &c
+}
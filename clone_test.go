@@ -0,0 +1,117 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func modelKeys(model map[string]bool) []string {
+	keys := make([]string, 0, len(model))
+	for key := range model {
+		keys = append(keys, key)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	return keys
+}
+
+func randOps(set *SortedSet, model map[string]bool, keys []string, n int) {
+	for i := 0; i < n; i++ {
+		key := keys[rand.Intn(len(keys))]
+		if rand.Intn(3) == 0 {
+			set.Delete(key)
+			delete(model, key)
+		} else {
+			set.Put(key)
+			model[key] = true
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	opts := map[string][]Option{
+		"bloom":    {WithBloom(0.01)},
+		"adaptive": {WithAdaptivePages(16, 256)},
+	}
+	for _, s := range storages {
+		opts[s.name] = []Option{WithStorage(s.storage)}
+	}
+	for name, opt := range opts {
+		set := New(append(opt, WithPageSize(16))...)
+		keys := randKeys(3000)
+		model := map[string]bool{}
+		randOps(set, model, keys, 3000)
+
+		clone := set.Clone()
+		cloneModel := map[string]bool{}
+		for key := range model {
+			cloneModel[key] = true
+		}
+		assert.Equal(t, set.Keys(), clone.Keys(), name)
+
+		// clone of clone
+		clone2 := clone.Clone()
+		want2 := clone.Keys()
+
+		randOps(set, model, keys, 3000)
+		randOps(clone, cloneModel, keys, 3000)
+		for _, s := range []*SortedSet{set, clone, clone2} {
+			assert.NoError(t, s.Validate(), name)
+		}
+		assert.Equal(t, modelKeys(model), set.Keys(), name)
+		assert.Equal(t, modelKeys(cloneModel), clone.Keys(), name)
+		assert.Equal(t, want2, clone2.Keys(), name)
+		set.Compact()
+		clone.Compact()
+		assert.NoError(t, set.Validate(), name)
+		assert.Equal(t, modelKeys(cloneModel), clone.Keys(), name)
+		assert.Equal(t, want2, clone2.Keys(), name)
+	}
+}
+
+func TestCloneConcurrent(t *testing.T) {
+	for _, s := range storages {
+		set := New(WithStorage(s.storage), WithPageSize(32))
+		keys := randKeys(2000)
+		for _, key := range keys {
+			set.Put(key)
+		}
+		sets := []*SortedSet{set, set.Clone(), set.Clone()}
+		var wg sync.WaitGroup
+		for i, set := range sets {
+			wg.Add(1)
+			go func(i int, set *SortedSet) {
+				defer wg.Done()
+				for j, key := range keys {
+					if j%len(sets) == i {
+						set.Delete(key)
+					} else {
+						set.Put(key + "x")
+						set.Has(key)
+					}
+				}
+			}(i, set)
+		}
+		wg.Wait()
+		for i, set := range sets {
+			assert.NoError(t, set.Validate())
+			deleted := (len(keys) - i + len(sets) - 1) / len(sets)
+			assert.Equal(t, len(keys)-deleted+len(keys)-deleted, set.Len())
+		}
+	}
+}
+
+func BenchmarkClone(b *testing.B) {
+	set := New()
+	for _, key := range randKeys(100000) {
+		set.Put(key)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := set.Clone()
+		c.Put("key")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// codec convert keys to and from printable form
+type codec struct {
+	format string // text, csv or jsonl
+	escape string // raw, hex or quote
+}
+
+func (c codec) check() error {
+	switch c.format {
+	case "text", "csv", "jsonl":
+	default:
+		return fmt.Errorf("unknown format %q, want text, csv or jsonl", c.format)
+	}
+	switch c.escape {
+	case "raw", "hex", "quote":
+	default:
+		return fmt.Errorf("unknown escape %q, want raw, hex or quote", c.escape)
+	}
+	return nil
+}
+
+func (c codec) encode(key string) (string, error) {
+	switch c.escape {
+	case "hex":
+		return hex.EncodeToString([]byte(key)), nil
+	case "quote":
+		return strconv.Quote(key), nil
+	}
+	if c.format == "text" && strings.ContainsAny(key, "\r\n") {
+		return "", fmt.Errorf("key %q contain newline, use -escape hex or quote", key)
+	}
+	if c.format == "jsonl" && !utf8.ValidString(key) {
+		return "", fmt.Errorf("key %q is not valid UTF-8, use -escape hex or quote", key)
+	}
+	return key, nil
+}
+
+func (c codec) decode(s string) (string, error) {
+	switch c.escape {
+	case "hex":
+		b, err := hex.DecodeString(s)
+		return string(b), err
+	case "quote":
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+type jsonKey struct {
+	Key string `json:"key"`
+}
+
+// keyWriter write keys one per record
+type keyWriter struct {
+	codec
+	w   *bufio.Writer
+	csv *csv.Writer
+}
+
+func newKeyWriter(w io.Writer, c codec) *keyWriter {
+	kw := &keyWriter{codec: c, w: bufio.NewWriter(w)}
+	if c.format == "csv" {
+		kw.csv = csv.NewWriter(kw.w)
+	}
+	return kw
+}
+
+// write key with optional extra fields, like count
+func (kw *keyWriter) write(key string, fields ...string) error {
+	s, err := kw.encode(key)
+	if err != nil {
+		return err
+	}
+	switch kw.format {
+	case "csv":
+		return kw.csv.Write(append([]string{s}, fields...))
+	case "jsonl":
+		if len(fields) > 0 {
+			_, err = fmt.Fprintf(kw.w, "{\"key\":%s,\"count\":%s}\n", jsonString(s), fields[0])
+			return err
+		}
+		_, err = fmt.Fprintf(kw.w, "{\"key\":%s}\n", jsonString(s))
+		return err
+	}
+	if len(fields) > 0 {
+		s += "\t" + strings.Join(fields, "\t")
+	}
+	_, err = kw.w.WriteString(s + "\n")
+	return err
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (kw *keyWriter) flush() error {
+	if kw.csv != nil {
+		kw.csv.Flush()
+		if err := kw.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return kw.w.Flush()
+}
+
+// readKeys call fn for every key in r
+func readKeys(r io.Reader, c codec, fn func(key string)) error {
+	var next func() (string, error)
+	switch c.format {
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		next = func() (string, error) {
+			rec, err := cr.Read()
+			if err != nil {
+				return "", err
+			}
+			return rec[0], nil
+		}
+	case "jsonl":
+		dec := json.NewDecoder(r)
+		next = func() (string, error) {
+			var k jsonKey
+			err := dec.Decode(&k)
+			return k.Key, err
+		}
+	default:
+		br := bufio.NewReader(r)
+		next = func() (string, error) {
+			line, err := br.ReadString('\n')
+			if err == io.EOF && line != "" {
+				err = nil
+			}
+			return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), err
+		}
+	}
+	for n := 1; ; n++ {
+		s, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+		key, err := c.decode(s)
+		if err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+		fn(key)
+	}
+}
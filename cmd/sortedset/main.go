@@ -0,0 +1,259 @@
+// Command sortedset inspect and edit snapshot files.
+//
+//	sortedset dump     [flags] file      print all keys
+//	sortedset load     [flags] file      write keys from stdin to snapshot
+//	sortedset count    [-prefix p] file  print number of keys
+//	sortedset range    [flags] file      print keys >= from and < to
+//	sortedset buckets  [-sep :] file     print bucket names and counts
+//	sortedset validate file              check snapshot
+//	sortedset stats    file              print pages stats
+//	sortedset compact  [flags] path      rewrite snapshot or compact store dir
+//
+// Keys are printed and read one per record as text lines, CSV or JSONL
+// ({"key": "..."}), -escape hex or quote handle binary keys
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/recoilme/sortedset"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "sortedset:", err)
+		os.Exit(1)
+	}
+}
+
+const usage = `usage: sortedset command [flags] file
+
+commands:
+  dump      print all keys
+  load      write keys from stdin to snapshot
+  count     print number of keys
+  range     print keys >= from and < to
+  buckets   print bucket names and number of keys
+  validate  check snapshot
+  stats     print pages stats
+  compact   rewrite snapshot or compact store directory
+
+run 'sortedset command -h' for command flags`
+
+var errUsage = errors.New(usage)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd := args[0]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var c codec
+	if cmd == "dump" || cmd == "load" || cmd == "range" || cmd == "buckets" {
+		fs.StringVar(&c.format, "format", "text", "text, csv or jsonl")
+		fs.StringVar(&c.escape, "escape", "raw", "raw, hex or quote")
+	}
+	desc := fs.Bool("desc", false, "descending order")
+	prefix, from, to, sep := new(string), new(string), new(string), new(string)
+	limit, pageSize := new(int), new(int)
+	appendKeys, deleteKeys := new(bool), new(bool)
+	switch cmd {
+	case "count":
+		fs.StringVar(prefix, "prefix", "", "count keys with prefix")
+	case "range":
+		fs.StringVar(from, "from", "", "first key, escaped like output")
+		fs.StringVar(to, "to", "", "key after the last one, empty for no bound")
+		fs.IntVar(limit, "limit", 0, "max keys, 0 for no limit")
+	case "buckets":
+		fs.StringVar(sep, "sep", ":", "bucket name end with separator")
+	case "load", "compact":
+		fs.IntVar(pageSize, "page-size", 256, "keys in snapshot page")
+	}
+	if cmd == "load" {
+		fs.BoolVar(appendKeys, "append", false, "add keys to existing snapshot")
+		fs.BoolVar(deleteKeys, "delete", false, "remove keys from existing snapshot")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	path := fs.Arg(0)
+	if c.format != "" {
+		if err := c.check(); err != nil {
+			return err
+		}
+	}
+	order := sortedset.Ascending
+	if *desc {
+		order = sortedset.Descending
+	}
+
+	switch cmd {
+	case "load":
+		return load(path, stdin, c, *pageSize, *appendKeys, *deleteKeys)
+	case "compact":
+		return compact(path, *pageSize)
+	case "dump", "count", "range", "buckets", "validate", "stats":
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+
+	m, err := sortedset.OpenSnapshot(path)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	switch cmd {
+	case "dump":
+		return printRange(m, "", "", order, 0, stdout, c)
+	case "range":
+		if *from, err = c.decode(*from); err != nil {
+			return fmt.Errorf("from: %v", err)
+		}
+		if *to, err = c.decode(*to); err != nil {
+			return fmt.Errorf("to: %v", err)
+		}
+		return printRange(m, *from, *to, order, *limit, stdout, c)
+	case "count":
+		n := 0
+		m.Range(*prefix, sortedset.PrefixEnd(*prefix), sortedset.Ascending, func(key string) bool {
+			if len(key) >= len(*prefix) && key[:len(*prefix)] == *prefix {
+				n++
+				return true
+			}
+			return false
+		})
+		fmt.Fprintln(stdout, n)
+	case "buckets":
+		return buckets(m, *sep, order, stdout, c)
+	case "validate":
+		if err := m.Validate(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "ok, %d keys\n", m.Len())
+	case "stats":
+		st := m.Stats()
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "keys\t%d\npages\t%d\nbytes\t%d\nfile\t%d\nmin_items\t%d\nmax_items\t%d\nfill\t%.2f\n",
+			st.Keys, st.Pages, st.Bytes, fi.Size(), st.MinItems, st.MaxItems, st.Fill)
+	}
+	return nil
+}
+
+func printRange(m *sortedset.MappedSet, from, to string, order sortedset.Order, limit int, stdout io.Writer, c codec) (err error) {
+	w := newKeyWriter(stdout, c)
+	n := 0
+	m.Range(from, to, order, func(key string) bool {
+		err = w.write(key)
+		n++
+		return err == nil && n != limit
+	})
+	if err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+// buckets print key prefixes up to separator with number of keys,
+// keys without separator are counted in bucket with empty name
+func buckets(m *sortedset.MappedSet, sep string, order sortedset.Order, stdout io.Writer, c codec) (err error) {
+	w := newKeyWriter(stdout, c)
+	name, count := "", 0
+	flush := func() bool {
+		if count > 0 {
+			err = w.write(name, strconv.Itoa(count))
+		}
+		return err == nil
+	}
+	m.Range("", "", order, func(key string) bool {
+		bucket := ""
+		if i := strings.Index(key, sep); i >= 0 {
+			bucket = key[:i+len(sep)]
+		}
+		// keys of bucket are next to each other
+		if bucket != name {
+			if !flush() {
+				return false
+			}
+			name, count = bucket, 0
+		}
+		count++
+		return true
+	})
+	if err == nil && flush() {
+		err = w.flush()
+	}
+	return err
+}
+
+// load build snapshot from keys in r
+func load(path string, r io.Reader, c codec, pageSize int, appendKeys, deleteKeys bool) error {
+	set, err := sortedset.NewWithError(sortedset.WithPageSize(pageSize))
+	if err != nil {
+		return err
+	}
+	if appendKeys || deleteKeys {
+		m, err := sortedset.OpenSnapshot(path)
+		if err != nil {
+			return err
+		}
+		m.Range("", "", sortedset.Ascending, func(key string) bool {
+			set.Put(key)
+			return true
+		})
+		m.Close()
+	}
+	err = readKeys(r, c, func(key string) {
+		if deleteKeys {
+			set.Delete(key)
+		} else {
+			set.Put(key)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return set.SaveSnapshot(path)
+}
+
+// compact rewrite snapshot with full pages, or compact runs of store
+func compact(path string, pageSize int) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		s, err := sortedset.OpenStore(path)
+		if err != nil {
+			return err
+		}
+		if err := s.Flush(); err != nil {
+			s.Close()
+			return err
+		}
+		if err := s.Compact(); err != nil {
+			s.Close()
+			return err
+		}
+		return s.Close()
+	}
+	return load(path, eofReader{}, codec{format: "text", escape: "raw"}, pageSize, true, false)
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
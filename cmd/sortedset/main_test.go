@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/recoilme/sortedset"
+	"github.com/stretchr/testify/assert"
+)
+
+func runCmd(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestLoadDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.snap")
+	_, err := runCmd(t, "user:bob\nuser:alice\nitem:1\nuser:rob\n", "load", "-page-size", "4", path)
+	assert.NoError(t, err)
+
+	out, err := runCmd(t, "", "dump", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "item:1\nuser:alice\nuser:bob\nuser:rob\n", out)
+
+	out, err = runCmd(t, "", "dump", "-desc", "-format", "jsonl", path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"key":"user:rob"}`+"\n", strings.SplitAfter(out, "\n")[0])
+
+	out, err = runCmd(t, "", "count", "-prefix", "user:", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "3\n", out)
+
+	out, err = runCmd(t, "", "range", "-from", "user:alice", "-to", "user:rob", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "user:alice\nuser:bob\n", out)
+
+	out, err = runCmd(t, "", "range", "-desc", "-limit", "1", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "user:rob\n", out)
+
+	out, err = runCmd(t, "", "buckets", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "item:\t1\nuser:\t3\n", out)
+
+	out, err = runCmd(t, "", "buckets", "-format", "jsonl", path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"key":"item:","count":1}`+"\n"+`{"key":"user:","count":3}`+"\n", out)
+
+	// append and delete keep other keys
+	_, err = runCmd(t, "item:2\n", "load", "-append", path)
+	assert.NoError(t, err)
+	_, err = runCmd(t, "user:bob\n", "load", "-delete", path)
+	assert.NoError(t, err)
+	out, err = runCmd(t, "", "dump", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "item:1\nitem:2\nuser:alice\nuser:rob\n", out)
+
+	out, err = runCmd(t, "", "validate", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok, 4 keys\n", out)
+
+	out, err = runCmd(t, "", "stats", path)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "keys\t4\n")
+}
+
+func TestBinaryKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bin.snap")
+	keys := []string{"a\nb", "\x00\xff", "plain"}
+	for _, c := range []codec{
+		{"text", "hex"}, {"text", "quote"}, {"csv", "raw"}, {"csv", "hex"}, {"jsonl", "quote"},
+	} {
+		var in bytes.Buffer
+		w := newKeyWriter(&in, c)
+		for _, key := range keys {
+			assert.NoError(t, w.write(key))
+		}
+		assert.NoError(t, w.flush())
+		_, err := runCmd(t, in.String(), "load", "-format", c.format, "-escape", c.escape, path)
+		assert.NoError(t, err, "%v", c)
+
+		out, err := runCmd(t, "", "dump", "-format", c.format, "-escape", c.escape, path)
+		assert.NoError(t, err, "%v", c)
+		var got []string
+		assert.NoError(t, readKeys(strings.NewReader(out), c, func(key string) {
+			got = append(got, key)
+		}))
+		assert.Equal(t, []string{"\x00\xff", "a\nb", "plain"}, got, "%v", c)
+	}
+
+	// raw text can't hold newline
+	_, err := runCmd(t, "", "dump", path)
+	assert.Error(t, err)
+	out, err := runCmd(t, "", "range", "-escape", "hex", "-from", "00", "-to", "61", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "00ff\n", out)
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.snap")
+	set := sortedset.New(sortedset.WithPageSize(4))
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		set.Put(key)
+	}
+	set.Delete("c")
+	set.Delete("e")
+	assert.NoError(t, set.SaveSnapshot(path))
+	_, err := runCmd(t, "", "compact", "-page-size", "64", path)
+	assert.NoError(t, err)
+	out, err := runCmd(t, "", "stats", path)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "pages\t1\n")
+
+	store, err := sortedset.OpenStore(filepath.Join(dir, "store"), sortedset.WithMemtableSize(2))
+	assert.NoError(t, err)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, store.Put(key))
+	}
+	assert.NoError(t, store.Delete("b"))
+	assert.NoError(t, store.Close())
+	_, err = runCmd(t, "", "compact", filepath.Join(dir, "store"))
+	assert.NoError(t, err)
+	store, err = sortedset.OpenStore(filepath.Join(dir, "store"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, store.Runs())
+	assert.Equal(t, []string{"e", "d", "c", "a"}, store.Keys())
+	assert.NoError(t, store.Close())
+}
+
+func TestUsage(t *testing.T) {
+	_, err := runCmd(t, "")
+	assert.Error(t, err)
+	_, err = runCmd(t, "", "nope", "file")
+	assert.Error(t, err)
+	_, err = runCmd(t, "", "dump", "-format", "xml", "file")
+	assert.Error(t, err)
+	_, err = runCmd(t, "", "dump", filepath.Join(t.TempDir(), "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,34 @@
+// Command sortedsetd serve named sorted sets over Redis protocol.
+//
+// Supported commands: PING, QUIT, COMMAND, SADD, SREM, SISMEMBER, SCARD,
+// ZRANGEBYLEX, ZREVRANGEBYLEX, ZLEXCOUNT, SCAN and SSCAN with MATCH/COUNT.
+// Sets are kept in memory, any redis client or redis-cli may be used:
+//
+//	sortedsetd -addr :6380
+//	redis-cli -p 6380 sadd users rob bob
+//	redis-cli -p 6380 zrangebylex users - +
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"github.com/recoilme/sortedset"
+)
+
+func main() {
+	addr := flag.String("addr", ":6380", "listen address")
+	pageSize := flag.Int("page-size", 256, "keys in page of set")
+	flag.Parse()
+	if _, err := sortedset.NewWithError(sortedset.WithPageSize(*pageSize)); err != nil {
+		log.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("sortedsetd listen on %s", ln.Addr())
+	log.Fatal(newServer(*pageSize).serve(ln))
+}
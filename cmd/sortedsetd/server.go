@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/recoilme/sortedset"
+)
+
+type server struct {
+	pageSize int
+
+	mu    sync.RWMutex
+	sets  map[string]*entry
+	names *sortedset.SortedSet // names of sets, for SCAN
+}
+
+// entry is a named set
+type entry struct {
+	mu  sync.Mutex // serialize writes, they reply number of changed keys
+	set *sortedset.SortedSet
+}
+
+func newServer(pageSize int) *server {
+	return &server{
+		pageSize: pageSize,
+		sets:     map[string]*entry{},
+		names:    sortedset.New(),
+	}
+}
+
+// serve accept connections until listener is closed
+func (s *server) serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := writer{bufio.NewWriter(conn)}
+	// bug in one connection must not stop server
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("sortedsetd: %s: panic: %v", conn.RemoteAddr(), err)
+			w.error("ERR internal error")
+			w.Flush()
+		}
+	}()
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.error(err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.exec(w, args)
+		// pipelined commands are answered together
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// get return set by name, nil if it's not exists and create is false
+func (s *server) get(name string, create bool) *entry {
+	s.mu.RLock()
+	e := s.sets[name]
+	s.mu.RUnlock()
+	if e != nil || !create {
+		return e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e = s.sets[name]; e == nil {
+		e = &entry{set: sortedset.New(sortedset.WithPageSize(s.pageSize))}
+		s.sets[name] = e
+		s.names.Put(name)
+	}
+	return e
+}
+
+func arity(w writer, args []string, min int) bool {
+	if len(args) < min {
+		w.error("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+		return false
+	}
+	return true
+}
+
+// exec run command, return true to close connection
+func (s *server) exec(w writer, args []string) bool {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		if len(args) > 1 {
+			w.bulk(args[1])
+		} else {
+			w.simple("PONG")
+		}
+	case "QUIT":
+		w.simple("OK")
+		return true
+	case "COMMAND":
+		w.array(0)
+	case "SADD":
+		if arity(w, args, 3) {
+			e := s.get(args[1], true)
+			e.mu.Lock()
+			added := 0
+			for _, key := range args[2:] {
+				if !e.set.Has(key) {
+					e.set.Put(key)
+					added++
+				}
+			}
+			e.mu.Unlock()
+			w.int(added)
+		}
+	case "SREM":
+		if arity(w, args, 3) {
+			removed := 0
+			if e := s.get(args[1], false); e != nil {
+				e.mu.Lock()
+				for _, key := range args[2:] {
+					if e.set.Delete(key) {
+						removed++
+					}
+				}
+				e.mu.Unlock()
+			}
+			w.int(removed)
+		}
+	case "SISMEMBER":
+		if arity(w, args, 3) {
+			e := s.get(args[1], false)
+			if e != nil && e.set.Has(args[2]) {
+				w.int(1)
+			} else {
+				w.int(0)
+			}
+		}
+	case "SCARD":
+		if arity(w, args, 2) {
+			n := 0
+			if e := s.get(args[1], false); e != nil {
+				n = e.set.Len()
+			}
+			w.int(n)
+		}
+	case "ZRANGEBYLEX":
+		if arity(w, args, 4) {
+			s.rangeByLex(w, args[1], args[2], args[3], args[4:], sortedset.Ascending)
+		}
+	case "ZREVRANGEBYLEX":
+		if arity(w, args, 4) {
+			s.rangeByLex(w, args[1], args[3], args[2], args[4:], sortedset.Descending)
+		}
+	case "ZLEXCOUNT":
+		if arity(w, args, 4) {
+			s.lexCount(w, args[1], args[2], args[3])
+		}
+	case "SCAN":
+		if arity(w, args, 2) {
+			s.scan(w, cursorKeys, "", args[1], args[2:], s.names, func(name string) bool {
+				e := s.get(name, false)
+				return e != nil && e.set.Len() > 0
+			})
+		}
+	case "SSCAN":
+		if arity(w, args, 3) {
+			set := sortedset.New()
+			if e := s.get(args[1], false); e != nil {
+				set = e.set
+			}
+			s.scan(w, cursorMembers, args[1], args[2], args[3:], set, nil)
+		}
+	default:
+		w.error("ERR unknown command '" + args[0] + "'")
+	}
+	return false
+}
+
+var errLex = errors.New("ERR min or max not valid string range item")
+
+// lexRange convert ZRANGEBYLEX min and max to range [from, to),
+// empty is true if range has no keys
+func lexRange(min, max string) (from, to string, empty bool, err error) {
+	switch {
+	case min == "-":
+	case min == "+":
+		empty = true
+	case strings.HasPrefix(min, "["):
+		from = min[1:]
+	case strings.HasPrefix(min, "("):
+		from = min[1:] + "\x00"
+	default:
+		return "", "", false, errLex
+	}
+	switch {
+	case max == "+":
+	case max == "-":
+		empty = true
+	case strings.HasPrefix(max, "["):
+		to = max[1:] + "\x00"
+	case max == "(":
+		// nothing is less than empty string
+		empty = true
+	case strings.HasPrefix(max, "("):
+		to = max[1:]
+	default:
+		return "", "", false, errLex
+	}
+	if to != "" && from >= to {
+		empty = true
+	}
+	return from, to, empty, nil
+}
+
+func (s *server) rangeByLex(w writer, name, min, max string, opts []string, order sortedset.Order) {
+	from, to, empty, err := lexRange(min, max)
+	if err != nil {
+		w.error(err.Error())
+		return
+	}
+	offset, count := 0, -1
+	if len(opts) > 0 {
+		if len(opts) != 3 || strings.ToUpper(opts[0]) != "LIMIT" {
+			w.error("ERR syntax error")
+			return
+		}
+		offset, err = strconv.Atoi(opts[1])
+		if err == nil {
+			count, err = strconv.Atoi(opts[2])
+		}
+		if err != nil {
+			w.error("ERR value is not an integer or out of range")
+			return
+		}
+	}
+	keys := []string{}
+	e := s.get(name, false)
+	if e == nil || empty || offset < 0 || count == 0 {
+		w.strings(keys)
+		return
+	}
+	e.set.Range(from, to, order, func(key string) bool {
+		if offset > 0 {
+			offset--
+			return true
+		}
+		keys = append(keys, key)
+		return count < 0 || len(keys) < count
+	})
+	w.strings(keys)
+}
+
+func (s *server) lexCount(w writer, name, min, max string) {
+	from, to, empty, err := lexRange(min, max)
+	if err != nil {
+		w.error(err.Error())
+		return
+	}
+	n := 0
+	if e := s.get(name, false); e != nil && !empty {
+		e.set.Range(from, to, sortedset.Ascending, func(key string) bool {
+			n++
+			return true
+		})
+	}
+	w.int(n)
+}
+
+// Cursor kinds, SCAN cursor is not valid for SSCAN
+const (
+	cursorKeys    byte = 'K'
+	cursorMembers byte = 'M'
+)
+
+// encodeCursor return cursor to continue scan of set after key,
+// server keep nothing between calls
+func encodeCursor(kind byte, name, key string) string {
+	b := append([]byte{kind}, strconv.Itoa(len(name))...)
+	b = append(append(append(b, ':'), name...), key...)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor return key to continue after, cursor must be of the same
+// kind and set
+func decodeCursor(cursor string, kind byte, name string) (string, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) == 0 || b[0] != kind {
+		return "", false
+	}
+	i := bytes.IndexByte(b, ':')
+	if i < 0 {
+		return "", false
+	}
+	n, err := strconv.Atoi(string(b[1:i]))
+	if err != nil || n < 0 || n > len(b)-i-1 || string(b[i+1:i+1+n]) != name {
+		return "", false
+	}
+	return string(b[i+1+n:]), true
+}
+
+// scan reply next cursor and keys of set matching MATCH option.
+// Cursor "0" start new scan, other cursors keep set name and the
+// last returned key, so they may be repeated and never expire
+func (s *server) scan(w writer, kind byte, name, cursor string, opts []string, set *sortedset.SortedSet, filter func(key string) bool) {
+	pattern, count := "*", 10
+	for i := 0; i < len(opts); i += 2 {
+		if i+1 == len(opts) {
+			w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(opts[i]) {
+		case "MATCH":
+			pattern = opts[i+1]
+		case "COUNT":
+			n, err := strconv.Atoi(opts[i+1])
+			if err != nil || n < 1 {
+				w.error("ERR value is not an integer or out of range")
+				return
+			}
+			count = n
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+	it := set.Match(pattern, 0)
+	if cursor != "0" {
+		after, ok := decodeCursor(cursor, kind, name)
+		if !ok {
+			w.error("ERR invalid cursor")
+			return
+		}
+		it.After(after)
+	}
+	keys := []string{}
+	more := false
+	last := ""
+	for n := 0; n < count; n++ {
+		if more = it.Next(); !more {
+			break
+		}
+		last = it.Key()
+		if filter == nil || filter(last) {
+			keys = append(keys, last)
+		}
+	}
+	next := "0"
+	if more {
+		next = encodeCursor(kind, name, last)
+	}
+	w.array(2)
+	w.bulk(next)
+	w.strings(keys)
+}
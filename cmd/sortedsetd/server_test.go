@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// client is a minimal RESP client
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newClient(t *testing.T) *client {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go newServer(4).serve(ln)
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do send command and return reply: string, int, error or []interface{}
+func (c *client) do(args ...string) interface{} {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write([]byte(b.String()))
+	assert.NoError(c.t, err)
+	return c.read()
+}
+
+func (c *client) read() interface{} {
+	line, err := readLine(c.r)
+	assert.NoError(c.t, err)
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return fmt.Errorf("%s", line[1:])
+	case ':':
+		n, _ := strconv.Atoi(line[1:])
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		buf := make([]byte, n+2)
+		_, err := io.ReadFull(c.r, buf)
+		assert.NoError(c.t, err)
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := []interface{}{}
+		for i := 0; i < n; i++ {
+			items = append(items, c.read())
+		}
+		return items
+	}
+	c.t.Fatalf("bad reply %q", line)
+	return nil
+}
+
+func list(keys ...string) []interface{} {
+	items := []interface{}{}
+	for _, key := range keys {
+		items = append(items, key)
+	}
+	return items
+}
+
+func TestCommands(t *testing.T) {
+	c := newClient(t)
+	assert.Equal(t, "PONG", c.do("PING"))
+	assert.Equal(t, "hi", c.do("ping", "hi"))
+	assert.Equal(t, 3, c.do("SADD", "users", "rob", "bob", "pike"))
+	assert.Equal(t, 1, c.do("SADD", "users", "rob", "alice"))
+	assert.Equal(t, 1, c.do("SISMEMBER", "users", "bob"))
+	assert.Equal(t, 0, c.do("SISMEMBER", "users", "anna"))
+	assert.Equal(t, 0, c.do("SISMEMBER", "none", "anna"))
+	assert.Equal(t, 4, c.do("SCARD", "users"))
+	assert.Equal(t, 1, c.do("SREM", "users", "bob", "anna"))
+	assert.Equal(t, 0, c.do("SREM", "none", "bob"))
+
+	assert.Equal(t, list("alice", "pike", "rob"), c.do("ZRANGEBYLEX", "users", "-", "+"))
+	assert.Equal(t, list("pike"), c.do("ZRANGEBYLEX", "users", "(alice", "(rob"))
+	assert.Equal(t, list("alice", "pike"), c.do("ZRANGEBYLEX", "users", "[alice", "[pike"))
+	assert.Equal(t, list("pike", "rob"), c.do("ZRANGEBYLEX", "users", "-", "+", "LIMIT", "1", "5"))
+	assert.Equal(t, list("rob", "pike", "alice"), c.do("ZREVRANGEBYLEX", "users", "+", "-"))
+	assert.Equal(t, list("pike"), c.do("ZREVRANGEBYLEX", "users", "[rob", "-", "limit", "1", "1"))
+	assert.Equal(t, list(), c.do("ZRANGEBYLEX", "users", "+", "-"))
+	assert.Equal(t, list(), c.do("ZRANGEBYLEX", "users", "-", "("))
+	assert.Equal(t, list(), c.do("ZRANGEBYLEX", "none", "-", "+"))
+	assert.Equal(t, 2, c.do("ZLEXCOUNT", "users", "[p", "+"))
+	assert.Equal(t, 3, c.do("ZLEXCOUNT", "users", "-", "+"))
+
+	assert.Error(t, c.do("ZRANGEBYLEX", "users", "a", "+").(error))
+	assert.Error(t, c.do("ZRANGEBYLEX", "users", "-", "+", "LIMIT", "x", "1").(error))
+	assert.Error(t, c.do("SADD", "users").(error))
+	assert.Error(t, c.do("GET", "users").(error))
+}
+
+func TestScan(t *testing.T) {
+	c := newClient(t)
+	var keys []string
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("k%03d", i))
+	}
+	c.do(append([]string{"SADD", "big"}, keys...)...)
+	c.do("SADD", "small", "x")
+	c.do("SADD", "empty", "x")
+	c.do("SREM", "empty", "x")
+
+	scanAll := func(args ...string) (all []string, calls int) {
+		cursor := "0"
+		for {
+			cmd := append([]string{}, args[:len(args)-1]...)
+			cmd = append(cmd, cursor)
+			if args[len(args)-1] != "" {
+				cmd = append(cmd, strings.Fields(args[len(args)-1])...)
+			}
+			reply := c.do(cmd...).([]interface{})
+			for _, key := range reply[1].([]interface{}) {
+				all = append(all, key.(string))
+			}
+			calls++
+			cursor = reply[0].(string)
+			if cursor == "0" {
+				return all, calls
+			}
+		}
+	}
+	all, calls := scanAll("SSCAN", "big", "COUNT 7")
+	assert.Equal(t, 100, len(all))
+	assert.True(t, calls >= 15)
+	all, _ = scanAll("SSCAN", "big", "MATCH k05? COUNT 3")
+	assert.Equal(t, []string{"k059", "k058", "k057", "k056", "k055", "k054", "k053", "k052", "k051", "k050"}, all)
+	all, _ = scanAll("SCAN", "")
+	assert.Equal(t, []string{"small", "big"}, all)
+	all, _ = scanAll("SCAN", "MATCH s*")
+	assert.Equal(t, []string{"small"}, all)
+	all, _ = scanAll("SSCAN", "none", "")
+	assert.Empty(t, all)
+	assert.Error(t, c.do("SCAN", "42").(error))
+	assert.Error(t, c.do("SCAN", "0", "COUNT").(error))
+
+	// cursor is bound to set and may be repeated
+	c.do("SADD", "secret", "s1", "s2", "s3")
+	reply := c.do("SSCAN", "secret", "0", "COUNT", "1").([]interface{})
+	cursor := reply[0].(string)
+	assert.Equal(t, []interface{}{"s3"}, reply[1])
+	assert.Error(t, c.do("SSCAN", "big", cursor).(error))
+	assert.Error(t, c.do("SSCAN", "secre", cursor).(error))
+	assert.Error(t, c.do("SCAN", cursor).(error))
+	for i := 0; i < 2; i++ {
+		reply = c.do("SSCAN", "secret", cursor, "COUNT", "1").([]interface{})
+		assert.Equal(t, []interface{}{"s2"}, reply[1])
+	}
+	// many scans at once don't evict each other
+	var cursors []string
+	for i := 0; i < 2000; i++ {
+		reply = c.do("SSCAN", "big", "0", "COUNT", "1").([]interface{})
+		cursors = append(cursors, reply[0].(string))
+	}
+	reply = c.do("SSCAN", "big", cursors[0], "COUNT", "1").([]interface{})
+	assert.Equal(t, []interface{}{"k098"}, reply[1])
+}
+
+func TestPipelineAndInline(t *testing.T) {
+	c := newClient(t)
+	_, err := c.conn.Write([]byte("*3\r\n$4\r\nSADD\r\n$1\r\ns\r\n$1\r\na\r\n*3\r\n$4\r\nSADD\r\n$1\r\ns\r\n$1\r\nb\r\nSCARD s\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.read())
+	assert.Equal(t, 1, c.read())
+	assert.Equal(t, 2, c.read())
+	assert.Equal(t, "OK", c.do("QUIT"))
+}
+
+func TestMalformedHeader(t *testing.T) {
+	for _, header := range []string{"*-1\r\n", "*0\r\n", "*-100\r\n"} {
+		args, err := readCommand(bufio.NewReader(strings.NewReader(header)))
+		assert.NoError(t, err)
+		assert.Empty(t, args)
+	}
+	_, err := readCommand(bufio.NewReader(strings.NewReader("*x\r\n")))
+	assert.Equal(t, errProtocol, err)
+	_, err = readCommand(bufio.NewReader(strings.NewReader("*2000000\r\n")))
+	assert.Equal(t, errProtocol, err)
+
+	// server keep serving after malformed headers
+	c := newClient(t)
+	_, err = c.conn.Write([]byte("*-1\r\n*-5\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.do("SADD", "s", "a"))
+	_, err = c.conn.Write([]byte("*1x\r\n"))
+	assert.NoError(t, err)
+	assert.Error(t, c.read().(error))
+}
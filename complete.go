@@ -0,0 +1,64 @@
+package sortedset
+
+import "strings"
+
+// Complete return up to n keys with prefix in order,
+// if n <= 0 - no limit
+func (set *SortedSet) Complete(prefix string, order Order, n int) (result []string) {
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	for idxPage, idxItem := set.seekPrefix(prefix, "", false, order); n <= 0 || len(result) < n; idxPage, idxItem = set.step(idxPage, idxItem, order) {
+		key, ok := set.at(idxPage, idxItem)
+		if !ok || !strings.HasPrefix(key, prefix) {
+			break
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+// CompleteSegments return up to n distinct completions of prefix to the
+// end of the next segment in order, like shell completion of paths.
+// Completion of keys with sep after prefix end with sep, other keys are
+// returned whole:
+//
+//	keys "usr/bin/ls", "usr/bin/cat", "usr/lib/x", "usr/local"
+//	CompleteSegments("usr/", "/", Ascending, 0) = "usr/bin/", "usr/lib/", "usr/local"
+//
+// Keys of the same segment are skipped by search, not scanned.
+// if n <= 0 - no limit
+func (set *SortedSet) CompleteSegments(prefix, sep string, order Order, n int) (result []string) {
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	idxPage, idxItem := set.seekPrefix(prefix, "", false, order)
+	for n <= 0 || len(result) < n {
+		key, ok := set.at(idxPage, idxItem)
+		if !ok || !strings.HasPrefix(key, prefix) {
+			break
+		}
+		i := -1
+		if sep != "" {
+			i = strings.Index(key[len(prefix):], sep)
+		}
+		if i < 0 {
+			result = append(result, key)
+			idxPage, idxItem = set.step(idxPage, idxItem, order)
+			continue
+		}
+		segment := key[:len(prefix)+i+len(sep)]
+		result = append(result, segment)
+		// jump over keys with segment
+		if order == Descending {
+			idxPage, idxItem = set.search(func(key string) bool {
+				return key < segment
+			})
+			continue
+		}
+		end := PrefixEnd(segment)
+		if end == "" {
+			break
+		}
+		idxPage, idxItem = rangeStart(set, end, "", Ascending)
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package sortedset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	set := New(WithPageSize(4))
+	for _, key := range []string{"apple", "apricot", "banana", "app", "application", "b"} {
+		set.Put(key)
+	}
+	assert.Equal(t, []string{"apricot", "application", "apple", "app"}, set.Complete("ap", Descending, 0))
+	assert.Equal(t, []string{"apricot", "application"}, set.Complete("ap", Descending, 2))
+	assert.Equal(t, []string{"application", "apple", "app"}, set.Complete("app", Descending, 0))
+	assert.Nil(t, set.Complete("c", Descending, 10))
+	assert.Equal(t, 6, len(set.Complete("", Descending, 0)))
+
+	// both orders on the same set
+	assert.Equal(t, []string{"app", "apple", "application"}, set.Complete("app", Ascending, 3))
+	assert.Equal(t, []string{"app", "apple"}, set.Complete("ap", Ascending, 2))
+	assert.Equal(t, []string{"b", "banana"}, set.Complete("b", Ascending, 0))
+	assert.Equal(t, []string{"banana", "b"}, set.Complete("b", Descending, 0))
+	assert.Nil(t, set.Complete("c", Ascending, 10))
+	assert.Equal(t, 6, len(set.Complete("", Ascending, 0)))
+}
+
+func TestCompleteSegments(t *testing.T) {
+	paths := []string{
+		"usr/bin/ls", "usr/bin/cat", "usr/bin/", "usr/lib/x/y", "usr/lib/z",
+		"usr/local", "usr/local2", "usr", "var/log/syslog", "usr/\xff/a", "usr/\xff\xff/",
+	}
+	set := New(WithPageSize(4))
+	for _, key := range paths {
+		set.Put(key)
+	}
+	for _, order := range []Order{Descending, Ascending} {
+		want := []string{"usr/bin/", "usr/lib/", "usr/local", "usr/local2", "usr/\xff/", "usr/\xff\xff/"}
+		if order == Descending {
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+		}
+		assert.Equal(t, want, set.CompleteSegments("usr/", "/", order, 0), "%d", order)
+		assert.Equal(t, want[:2], set.CompleteSegments("usr/", "/", order, 2))
+		got := set.CompleteSegments("u", "/", order, 0)
+		assert.ElementsMatch(t, []string{"usr", "usr/"}, got)
+		assert.ElementsMatch(t, []string{"usr/lib/x/", "usr/lib/z"}, set.CompleteSegments("usr/lib/", "/", order, 0))
+		assert.ElementsMatch(t, []string{"usr/local", "usr/local2"}, set.CompleteSegments("usr/lo", "", order, 0))
+		assert.ElementsMatch(t, []string{"usr", "usr/", "var/"}, set.CompleteSegments("", "/", order, 0))
+	}
+}
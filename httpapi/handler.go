@@ -0,0 +1,343 @@
+// Package httpapi expose SortedSet over HTTP with JSON responses.
+//
+// Routes, keys in path are URL-escaped:
+//
+//	PUT    /keys/{key}      add key, 204
+//	DELETE /keys/{key}      remove key, 204 or 404
+//	HEAD   /keys/{key}      200 if key in set, 404 otherwise
+//	GET    /keys/{key}      same as HEAD, with {"key": key}
+//	GET    /buckets/{name}  page of bucket keys: ?limit=100&cursor=&order=asc|desc,
+//	                        reply {"keys": [...], "next": cursor}
+//	GET    /range           keys >= from and < to: ?from=&to=&order=asc|desc&limit=,
+//	                        streamed as NDJSON, one {"key": key} per line
+//	GET    /stats           set stats
+//
+// JSON strings are UTF-8, so keys are returned as is only if they are valid
+// UTF-8, otherwise request fail with 422. Binary keys need ?encoding=hex or
+// ?encoding=base64 (URL-safe, without padding): keys in path, bucket name,
+// from and to are decoded and keys in reply are encoded with it.
+//
+// Handler may be mounted under prefix with http.StripPrefix
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/recoilme/sortedset"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 10000
+	// rangeBatch is a number of keys read under set lock while streaming
+	rangeBatch = 1000
+)
+
+// Handler serve set over HTTP
+type Handler struct {
+	set      *sortedset.SortedSet
+	readOnly bool
+}
+
+// NewHandler return handler for set
+func NewHandler(set *sortedset.SortedSet) *Handler {
+	return &Handler{set: set}
+}
+
+// ReadOnly reject PUT and DELETE with 405
+func (h *Handler) ReadOnly() *Handler {
+	h.readOnly = true
+	return h
+}
+
+type keyReply struct {
+	Key string `json:"key"`
+}
+
+type bucketReply struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next"`
+}
+
+type errorReply struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorReply{Error: err.Error()})
+}
+
+var (
+	errMethod = errors.New("method not allowed")
+	errUTF8   = errors.New("key is not valid UTF-8, use encoding=hex or encoding=base64")
+)
+
+// codec encode keys in reply and decode keys in request
+type codec struct {
+	encode func(key string) (string, error)
+	decode func(s string) (string, error)
+}
+
+var codecs = map[string]codec{
+	"": {
+		encode: func(key string) (string, error) {
+			if !utf8.ValidString(key) {
+				return "", errUTF8
+			}
+			return key, nil
+		},
+		decode: func(s string) (string, error) { return s, nil },
+	},
+	"hex": {
+		encode: func(key string) (string, error) {
+			return hex.EncodeToString([]byte(key)), nil
+		},
+		decode: func(s string) (string, error) {
+			b, err := hex.DecodeString(s)
+			return string(b), err
+		},
+	},
+	"base64": {
+		encode: func(key string) (string, error) {
+			return base64.RawURLEncoding.EncodeToString([]byte(key)), nil
+		},
+		decode: func(s string) (string, error) {
+			b, err := base64.RawURLEncoding.DecodeString(s)
+			return string(b), err
+		},
+	},
+}
+
+// parseEncoding parse encoding parameter, default is raw UTF-8 keys
+func parseEncoding(q url.Values) (codec, error) {
+	c, ok := codecs[q.Get("encoding")]
+	if !ok {
+		return codec{}, errors.New("encoding must be hex or base64")
+	}
+	return c, nil
+}
+
+// pathKey unescape and decode key in path
+func pathKey(c codec, escaped string) (string, error) {
+	s, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", err
+	}
+	return c.decode(s)
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	c, err := parseEncoding(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch {
+	case strings.HasPrefix(path, "/keys/"):
+		key, err := pathKey(c, path[len("/keys/"):])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		h.serveKey(w, r, c, key)
+	case strings.HasPrefix(path, "/buckets/"):
+		name, err := pathKey(c, path[len("/buckets/"):])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errMethod)
+			return
+		}
+		h.serveBucket(w, r, c, name)
+	case path == "/range":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errMethod)
+			return
+		}
+		h.serveRange(w, r, c)
+	case path == "/stats":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errMethod)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.set.Stats())
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, c codec, key string) {
+	if h.readOnly && (r.Method == http.MethodPut || r.Method == http.MethodDelete) {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("set is read-only"))
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		h.set.Put(key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if !h.set.Delete(key) {
+			writeError(w, http.StatusNotFound, errors.New("key not found"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodHead:
+		if !h.set.Has(key) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		if !h.set.Has(key) {
+			writeError(w, http.StatusNotFound, errors.New("key not found"))
+			return
+		}
+		s, err := c.encode(key)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, keyReply{Key: s})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errMethod)
+	}
+}
+
+// parseOrder parse order parameter, default is ascending
+func parseOrder(q url.Values) (sortedset.Order, error) {
+	switch q.Get("order") {
+	case "", "asc":
+		return sortedset.Ascending, nil
+	case "desc":
+		return sortedset.Descending, nil
+	}
+	return 0, errors.New("order must be asc or desc")
+}
+
+// parseLimit parse limit parameter, 0 if max is 0 and limit is not set
+func parseLimit(q url.Values, def, max int) (int, error) {
+	s := q.Get("limit")
+	if s == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || (max > 0 && limit > max) {
+		return 0, errors.New("bad limit")
+	}
+	return limit, nil
+}
+
+func (h *Handler) serveBucket(w http.ResponseWriter, r *http.Request, c codec, name string) {
+	q := r.URL.Query()
+	order, err := parseOrder(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parseLimit(q, defaultLimit, maxLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	keys, next, err := sortedset.Bucket(h.set, name).Scan(order, q.Get("cursor"), limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	for i, key := range keys {
+		if keys[i], err = c.encode(key); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, bucketReply{Keys: keys, Next: next})
+}
+
+// serveRange stream keys in batches, set is locked only while batch is read
+func (h *Handler) serveRange(w http.ResponseWriter, r *http.Request, c codec) {
+	q := r.URL.Query()
+	order, err := parseOrder(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parseLimit(q, 0, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := c.decode(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := c.decode(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	n := 0
+	batch := make([]string, 0, rangeBatch)
+	for {
+		batch = batch[:0]
+		h.set.Range(from, to, order, func(key string) bool {
+			batch = append(batch, key)
+			return len(batch) < rangeBatch
+		})
+		for _, key := range batch {
+			if limit > 0 && n == limit {
+				return
+			}
+			s, err := c.encode(key)
+			if err != nil {
+				// status is sent already, error is the last line
+				enc.Encode(errorReply{Error: err.Error()})
+				return
+			}
+			if err := enc.Encode(keyReply{Key: s}); err != nil {
+				return
+			}
+			n++
+		}
+		if len(batch) < rangeBatch {
+			return
+		}
+		// continue after the last key
+		last := batch[len(batch)-1]
+		if order == sortedset.Ascending {
+			from = last + "\x00"
+		} else if last == "" {
+			// empty key is the smallest, empty to means no bound
+			return
+		} else {
+			to = last
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
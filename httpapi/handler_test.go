@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/recoilme/sortedset"
+	"github.com/stretchr/testify/assert"
+)
+
+func do(t *testing.T, h http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestKeys(t *testing.T) {
+	set := sortedset.New()
+	h := NewHandler(set)
+	key := "user/42 x"
+	path := "/keys/" + url.PathEscape(key)
+	assert.Equal(t, http.StatusNotFound, do(t, h, "HEAD", path).Code)
+	assert.Equal(t, http.StatusNoContent, do(t, h, "PUT", path).Code)
+	assert.True(t, set.Has(key))
+	assert.Equal(t, http.StatusOK, do(t, h, "HEAD", path).Code)
+	w := do(t, h, "GET", path)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"key":"user/42 x"}`, w.Body.String())
+	assert.Equal(t, http.StatusNoContent, do(t, h, "DELETE", path).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, h, "DELETE", path).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, h, "GET", path).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, h, "POST", path).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, h, "GET", "/nothing").Code)
+
+	h.ReadOnly()
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, h, "PUT", path).Code)
+	assert.False(t, set.Has(key))
+
+	// mounted under prefix
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", NewHandler(set)))
+	assert.Equal(t, http.StatusNoContent, do(t, mux, "PUT", "/api"+path).Code)
+	assert.True(t, set.Has(key))
+}
+
+func TestBuckets(t *testing.T) {
+	set := sortedset.New()
+	users := sortedset.Bucket(set, "user:")
+	for i := 0; i < 25; i++ {
+		users.Put(fmt.Sprintf("%02d", i))
+	}
+	set.Put("item:1")
+	h := NewHandler(set)
+
+	var all []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		w := do(t, h, "GET", "/buckets/user:?limit=10&order=desc&cursor="+url.QueryEscape(cursor))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var reply bucketReply
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+		all = append(all, reply.Keys...)
+		if reply.Next == "" {
+			assert.Equal(t, 2, pages)
+			break
+		}
+		cursor = reply.Next
+	}
+	assert.Equal(t, 25, len(all))
+	assert.Equal(t, "24", all[0])
+
+	w := do(t, h, "GET", "/buckets/none")
+	assert.JSONEq(t, `{"keys":[],"next":""}`, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, do(t, h, "GET", "/buckets/user:?cursor=bad").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, "GET", "/buckets/user:?limit=0").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, "GET", "/buckets/user:?order=up").Code)
+
+	w = do(t, h, "GET", "/stats")
+	var st sortedset.Stats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &st))
+	assert.Equal(t, 26, st.Keys)
+}
+
+func readRange(t *testing.T, h http.Handler, query string) (keys []string) {
+	w := do(t, h, "GET", "/range?"+query)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	sc := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for sc.Scan() {
+		var reply keyReply
+		assert.NoError(t, json.Unmarshal(sc.Bytes(), &reply))
+		keys = append(keys, reply.Key)
+	}
+	return keys
+}
+
+func TestRange(t *testing.T) {
+	set := sortedset.New()
+	for i := 0; i < 2500; i++ {
+		set.Put(fmt.Sprintf("%04d", i))
+	}
+	set.Put("")
+	h := NewHandler(set)
+
+	keys := readRange(t, h, "")
+	assert.Equal(t, 2501, len(keys))
+	assert.Equal(t, "", keys[0])
+	assert.Equal(t, "2499", keys[2500])
+	keys = readRange(t, h, "order=desc")
+	assert.Equal(t, 2501, len(keys))
+	assert.Equal(t, "2499", keys[0])
+	assert.Equal(t, "", keys[2500])
+	keys = readRange(t, h, "from=0100&to=0103")
+	assert.Equal(t, []string{"0100", "0101", "0102"}, keys)
+	keys = readRange(t, h, "from=0100&to=2000&order=desc&limit=1500")
+	assert.Equal(t, 1500, len(keys))
+	assert.Equal(t, "1999", keys[0])
+	assert.Equal(t, "0500", keys[1499])
+	assert.Equal(t, http.StatusBadRequest, do(t, h, "GET", "/range?limit=x").Code)
+}
+
+func TestBinaryKeys(t *testing.T) {
+	set := sortedset.New()
+	key := "bin:\xff\x00\xfe"
+	set.Put(key)
+	set.Put("bin:ok")
+	h := NewHandler(set)
+
+	// not valid UTF-8 keys are not returned as is
+	path := "/keys/" + url.PathEscape(key)
+	assert.Equal(t, http.StatusOK, do(t, h, "HEAD", path).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, do(t, h, "GET", path).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, do(t, h, "GET", "/buckets/bin:").Code)
+	w := do(t, h, "GET", "/range")
+	assert.Equal(t, `{"key":"bin:ok"}`+"\n"+`{"error":"`+errUTF8.Error()+`"}`+"\n", w.Body.String())
+
+	w = do(t, h, "GET", "/keys/62696e3aff00fe?encoding=hex")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"key":"62696e3aff00fe"}`, w.Body.String())
+	w = do(t, h, "GET", "/buckets/62696e3a?encoding=hex")
+	assert.JSONEq(t, `{"keys":["6f6b","ff00fe"],"next":""}`, w.Body.String())
+	keys := readRange(t, h, "encoding=base64&from=YmluOg&to=YmluOnA")
+	assert.Equal(t, []string{"YmluOm9r"}, keys)
+	keys = readRange(t, h, "encoding=base64&from=YmluOnA")
+	assert.Equal(t, []string{"YmluOv8A_g"}, keys)
+
+	assert.Equal(t, http.StatusNoContent, do(t, h, "PUT", "/keys/AAE?encoding=base64").Code)
+	assert.True(t, set.Has("\x00\x01"))
+	assert.Equal(t, http.StatusBadRequest, do(t, h, "GET", "/keys/zz?encoding=hex").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, "GET", "/range?encoding=hex&from=zz").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, "GET", "/keys/a?encoding=utf16").Code)
+}
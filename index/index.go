@@ -0,0 +1,220 @@
+// Package index maintain secondary indexes in bucket of SortedSet.
+//
+// Index map primary keys to indexed values, like user id to email, and
+// allow lookup of primary keys by value or by range of values. Entries
+// are stored in bucket as composite keys encoded with keyenc:
+//
+//	bucket + "v" + Tuple(value, pk)  forward entry, ordered by value
+//	bucket + "p" + Tuple(pk, value)  reverse entry, current value of pk
+//
+// Changes are made in sortedset transactions, so forward and reverse
+// entries stay in sync and unique check is atomic with insert.
+// Values are any type supported by keyenc.Append, they are returned as
+// decoded by keyenc.DecodeTuple, integers as int64 or uint64
+package index
+
+import (
+	"errors"
+
+	"github.com/recoilme/sortedset"
+	"github.com/recoilme/sortedset/keyenc"
+)
+
+const (
+	forward = "v"
+	reverse = "p"
+)
+
+// ErrDuplicate returned on Put of value of other key into unique index
+var ErrDuplicate = errors.New("index: duplicate value in unique index")
+
+// Index is a secondary index in bucket. Index must be changed only by
+// its methods, reads are safe for concurrent use with changes
+type Index struct {
+	set    *sortedset.SortedSet
+	name   string
+	unique bool
+}
+
+// New return non-unique index in bucket, many keys may have the same value
+func New(bkt *sortedset.BucketStore) *Index {
+	return &Index{set: bkt.Set, name: bkt.Name}
+}
+
+// NewUnique return unique index in bucket, value may belong only to one key
+func NewUnique(bkt *sortedset.BucketStore) *Index {
+	return &Index{set: bkt.Set, name: bkt.Name, unique: true}
+}
+
+// Put set value of pk, old value of pk is removed from index
+func (ix *Index) Put(pk string, value interface{}) error {
+	return ix.set.Update(func(tx *sortedset.Tx) error {
+		return ix.PutTx(tx, pk, value)
+	})
+}
+
+// PutTx is Put in transaction, to change index together with other keys
+func (ix *Index) PutTx(tx *sortedset.Tx, pk string, value interface{}) error {
+	valueKey, err := keyenc.Tuple(value)
+	if err != nil {
+		return err
+	}
+	old, ok, err := ix.valueTx(tx, pk)
+	if err != nil {
+		return err
+	}
+	if ok && old == valueKey {
+		return nil
+	}
+	if ix.unique {
+		c := tx.Bucket(ix.name + forward + valueKey).Cursor()
+		if c.First() {
+			return ErrDuplicate
+		}
+	}
+	if ok {
+		if err := ix.deleteTx(tx, pk, old); err != nil {
+			return err
+		}
+	}
+	pkKey := keyenc.MustTuple(pk)
+	if err := tx.Put(ix.name + forward + valueKey + pkKey); err != nil {
+		return err
+	}
+	return tx.Put(ix.name + reverse + pkKey + valueKey)
+}
+
+// Delete remove pk from index
+func (ix *Index) Delete(pk string) error {
+	return ix.set.Update(func(tx *sortedset.Tx) error {
+		return ix.DeleteTx(tx, pk)
+	})
+}
+
+// DeleteTx is Delete in transaction
+func (ix *Index) DeleteTx(tx *sortedset.Tx, pk string) error {
+	old, ok, err := ix.valueTx(tx, pk)
+	if err != nil || !ok {
+		return err
+	}
+	return ix.deleteTx(tx, pk, old)
+}
+
+func (ix *Index) deleteTx(tx *sortedset.Tx, pk, valueKey string) error {
+	pkKey := keyenc.MustTuple(pk)
+	if err := tx.Delete(ix.name + forward + valueKey + pkKey); err != nil {
+		return err
+	}
+	return tx.Delete(ix.name + reverse + pkKey + valueKey)
+}
+
+// valueTx return encoded value of pk
+func (ix *Index) valueTx(tx *sortedset.Tx, pk string) (string, bool, error) {
+	c := tx.Bucket(ix.name + reverse + keyenc.MustTuple(pk)).Cursor()
+	if !c.First() {
+		return "", false, nil
+	}
+	return c.Key(), true, nil
+}
+
+// Value return value of pk
+func (ix *Index) Value(pk string) (value interface{}, ok bool, err error) {
+	prefix := ix.name + reverse + keyenc.MustTuple(pk)
+	ix.set.Range(prefix, sortedset.PrefixEnd(prefix), sortedset.Ascending, func(key string) bool {
+		value, err = decodeValue(key[len(prefix):])
+		ok = err == nil
+		return false
+	})
+	return value, ok, err
+}
+
+// Get return primary keys with value in ascending order
+func (ix *Index) Get(value interface{}) ([]string, error) {
+	valueKey, err := keyenc.Tuple(value)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ix.name + forward + valueKey
+	var pks []string
+	ix.set.Range(prefix, sortedset.PrefixEnd(prefix), sortedset.Ascending, func(key string) bool {
+		var pk string
+		if pk, err = decodePK(key[len(prefix):]); err != nil {
+			return false
+		}
+		pks = append(pks, pk)
+		return true
+	})
+	return pks, err
+}
+
+// Lookup return the only key with value in unique index,
+// the smallest one in non-unique
+func (ix *Index) Lookup(value interface{}) (pk string, ok bool, err error) {
+	pks, err := ix.Get(value)
+	if err != nil || len(pks) == 0 {
+		return "", false, err
+	}
+	return pks[0], true, nil
+}
+
+// Range call fn for entries with values >= from and < to, ordered by value
+// and primary key, until fn return false. nil from start from the smallest
+// value, nil to means no upper bound
+func (ix *Index) Range(from, to interface{}, order sortedset.Order, fn func(value interface{}, pk string) bool) error {
+	prefix := ix.name + forward
+	start, end := prefix, sortedset.PrefixEnd(prefix)
+	if from != nil {
+		v, err := keyenc.Tuple(from)
+		if err != nil {
+			return err
+		}
+		start = prefix + v
+	}
+	if to != nil {
+		v, err := keyenc.Tuple(to)
+		if err != nil {
+			return err
+		}
+		end = prefix + v
+	}
+	var err error
+	ix.set.Range(start, end, order, func(key string) bool {
+		var values []interface{}
+		values, err = keyenc.DecodeTuple(key[len(prefix):])
+		if err == nil && len(values) != 2 {
+			err = keyenc.ErrInvalid
+		}
+		if err != nil {
+			return false
+		}
+		pk, _ := values[1].(string)
+		return fn(values[0], pk)
+	})
+	return err
+}
+
+func decodeValue(valueKey string) (interface{}, error) {
+	values, err := keyenc.DecodeTuple(valueKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 1 {
+		return nil, keyenc.ErrInvalid
+	}
+	return values[0], nil
+}
+
+func decodePK(pkKey string) (string, error) {
+	values, err := keyenc.DecodeTuple(pkKey)
+	if err != nil {
+		return "", err
+	}
+	if len(values) != 1 {
+		return "", keyenc.ErrInvalid
+	}
+	pk, ok := values[0].(string)
+	if !ok {
+		return "", keyenc.ErrInvalid
+	}
+	return pk, nil
+}
@@ -0,0 +1,142 @@
+package index
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/recoilme/sortedset"
+	"github.com/recoilme/sortedset/keyenc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnique(t *testing.T) {
+	set := sortedset.New()
+	emails := NewUnique(sortedset.Bucket(set, "email:"))
+	assert.NoError(t, emails.Put("1", "rob@example.com"))
+	assert.NoError(t, emails.Put("2", "bob@example.com"))
+	assert.NoError(t, emails.Put("2", "bob@example.com"))
+	assert.Equal(t, ErrDuplicate, emails.Put("3", "rob@example.com"))
+
+	pk, ok, err := emails.Lookup("rob@example.com")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "1", pk)
+
+	// change value, old one is free
+	assert.NoError(t, emails.Put("1", "pike@example.com"))
+	_, ok, err = emails.Lookup("rob@example.com")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, emails.Put("3", "rob@example.com"))
+	v, ok, err := emails.Value("1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "pike@example.com", v)
+
+	assert.NoError(t, emails.Delete("3"))
+	assert.NoError(t, emails.Delete("3"))
+	_, ok, _ = emails.Value("3")
+	assert.False(t, ok)
+	// forward and reverse entry for every key
+	assert.Equal(t, 4, set.Len())
+
+	assert.Error(t, emails.Put("4", struct{}{}))
+	_, err = emails.Get(nil)
+	assert.Error(t, err)
+}
+
+func TestNonUnique(t *testing.T) {
+	set := sortedset.New(sortedset.WithPageSize(4))
+	set.Put("user:1")
+	ages := New(sortedset.Bucket(set, "age:"))
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, ages.Put(fmt.Sprint(i), int64(20+i%5)))
+	}
+	pks, err := ages.Get(int64(22))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"12", "17", "2", "7"}, pks)
+
+	var got []string
+	assert.NoError(t, ages.Range(int64(21), int64(23), sortedset.Ascending, func(value interface{}, pk string) bool {
+		got = append(got, fmt.Sprint(value, "/", pk))
+		return true
+	}))
+	assert.Equal(t, []string{"21/1", "21/11", "21/16", "21/6", "22/12", "22/17", "22/2", "22/7"}, got)
+
+	got = got[:0]
+	assert.NoError(t, ages.Range(nil, nil, sortedset.Descending, func(value interface{}, pk string) bool {
+		got = append(got, fmt.Sprint(value, "/", pk))
+		return len(got) < 2
+	}))
+	assert.Equal(t, []string{"24/9", "24/4"}, got)
+
+	assert.NoError(t, ages.Put("2", int64(30)))
+	pks, _ = ages.Get(int64(22))
+	assert.Equal(t, []string{"12", "17", "7"}, pks)
+	got = got[:0]
+	assert.NoError(t, ages.Range(int64(25), nil, sortedset.Ascending, func(value interface{}, pk string) bool {
+		got = append(got, fmt.Sprint(value, "/", pk))
+		return true
+	}))
+	assert.Equal(t, []string{"30/2"}, got)
+	assert.True(t, set.Has("user:1"))
+	assert.NoError(t, set.Validate())
+}
+
+func TestTx(t *testing.T) {
+	set := sortedset.New()
+	emails := NewUnique(sortedset.Bucket(set, "email:"))
+	// record and index change together or not at all
+	err := set.Update(func(tx *sortedset.Tx) error {
+		if err := tx.Put("user:1"); err != nil {
+			return err
+		}
+		return emails.PutTx(tx, "1", "rob@example.com")
+	})
+	assert.NoError(t, err)
+	err = set.Update(func(tx *sortedset.Tx) error {
+		if err := tx.Put("user:2"); err != nil {
+			return err
+		}
+		return emails.PutTx(tx, "2", "rob@example.com")
+	})
+	assert.Equal(t, ErrDuplicate, err)
+	assert.False(t, set.Has("user:2"))
+
+	// concurrent puts of the same value, only one win
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if emails.Put(fmt.Sprint("u", i), "pike@example.com") == nil {
+				wins.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), wins.Load())
+	pks, err := emails.Get("pike@example.com")
+	assert.NoError(t, err)
+	assert.Len(t, pks, 1)
+}
+
+func TestCorruptEntry(t *testing.T) {
+	set := sortedset.New()
+	ix := New(sortedset.Bucket(set, "ix:"))
+	assert.NoError(t, ix.Put("1", "a"))
+	// forward entry without pk
+	set.Put("ix:" + forward + keyenc.MustTuple("b"))
+	_, err := ix.Get("b")
+	assert.Equal(t, keyenc.ErrInvalid, err)
+	// pk of other type
+	set.Put("ix:" + forward + keyenc.MustTuple("c", int64(1)))
+	_, err = ix.Get("c")
+	assert.Equal(t, keyenc.ErrInvalid, err)
+	pks, err := ix.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, pks)
+}
@@ -0,0 +1,267 @@
+// Package keyenc encode values into byte-comparable strings.
+//
+// Sorted set compare keys as raw strings, so numbers, times and composite
+// keys must be encoded in a way where byte order equals value order.
+// Append* functions encode a single value without type information,
+// Tuple encode a list of values with type tags, so tuple may be decoded
+// back with DecodeTuple and a tuple is a prefix of any longer tuple
+// starting with the same values:
+//
+//	key := keyenc.MustTuple("tenant1", time.Now(), int64(42))
+//	bkt := sortedset.Bucket(set, keyenc.MustTuple("tenant1"))
+package keyenc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	// ErrShort returned when input ends in the middle of value
+	ErrShort = errors.New("keyenc: short input")
+	// ErrInvalid returned on malformed input
+	ErrInvalid = errors.New("keyenc: invalid encoding")
+)
+
+// type tags of tuple elements, order of tags is order of types
+const (
+	tagString byte = 0x02
+	tagInt    byte = 0x14
+	tagUint   byte = 0x15
+	tagFloat  byte = 0x21
+	tagFalse  byte = 0x26
+	tagTrue   byte = 0x27
+	tagTime   byte = 0x33
+)
+
+// AppendUint append v as 8 bytes big endian
+func AppendUint(b []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+// DecodeUint decode value encoded with AppendUint, return rest of input
+func DecodeUint(b []byte) (uint64, []byte, error) {
+	if len(b) < 8 {
+		return 0, b, ErrShort
+	}
+	return binary.BigEndian.Uint64(b), b[8:], nil
+}
+
+// AppendInt append v as 8 bytes big endian with flipped sign bit,
+// so negative numbers sort before positive
+func AppendInt(b []byte, v int64) []byte {
+	return AppendUint(b, uint64(v)^(1<<63))
+}
+
+// DecodeInt decode value encoded with AppendInt, return rest of input
+func DecodeInt(b []byte) (int64, []byte, error) {
+	u, rest, err := DecodeUint(b)
+	return int64(u ^ (1 << 63)), rest, err
+}
+
+// AppendFloat append v as 8 bytes: sign bit is flipped for positive
+// numbers and all bits are flipped for negative
+func AppendFloat(b []byte, v float64) []byte {
+	u := math.Float64bits(v)
+	if u&(1<<63) != 0 {
+		u = ^u
+	} else {
+		u |= 1 << 63
+	}
+	return AppendUint(b, u)
+}
+
+// DecodeFloat decode value encoded with AppendFloat, return rest of input
+func DecodeFloat(b []byte) (float64, []byte, error) {
+	u, rest, err := DecodeUint(b)
+	if u&(1<<63) != 0 {
+		u &^= 1 << 63
+	} else {
+		u = ^u
+	}
+	return math.Float64frombits(u), rest, err
+}
+
+// AppendTime append t as seconds (AppendInt) and nanoseconds (4 bytes).
+// Location is not stored
+func AppendTime(b []byte, t time.Time) []byte {
+	b = AppendInt(b, t.Unix())
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+// DecodeTime decode value encoded with AppendTime in UTC, return rest of input
+func DecodeTime(b []byte) (time.Time, []byte, error) {
+	sec, rest, err := DecodeInt(b)
+	if err != nil {
+		return time.Time{}, b, err
+	}
+	if len(rest) < 4 {
+		return time.Time{}, b, ErrShort
+	}
+	nsec := binary.BigEndian.Uint32(rest)
+	if nsec >= 1e9 {
+		return time.Time{}, b, ErrInvalid
+	}
+	return time.Unix(sec, int64(nsec)).UTC(), rest[4:], nil
+}
+
+// AppendBool append false as 0x00 and true as 0x01
+func AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// DecodeBool decode value encoded with AppendBool, return rest of input
+func DecodeBool(b []byte) (bool, []byte, error) {
+	if len(b) < 1 {
+		return false, b, ErrShort
+	}
+	switch b[0] {
+	case 0:
+		return false, b[1:], nil
+	case 1:
+		return true, b[1:], nil
+	}
+	return false, b, ErrInvalid
+}
+
+// AppendString append s with 0x00 escaped as 0x00 0xFF and terminated
+// by 0x00 0x01, so a string sorts before any longer string with same prefix
+func AppendString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		b = append(b, s[i])
+		if s[i] == 0 {
+			b = append(b, 0xFF)
+		}
+	}
+	return append(b, 0, 1)
+}
+
+// DecodeString decode value encoded with AppendString, return rest of input
+func DecodeString(b []byte) (string, []byte, error) {
+	var s []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0 {
+			s = append(s, b[i])
+			continue
+		}
+		if i+1 == len(b) {
+			return "", b, ErrShort
+		}
+		switch b[i+1] {
+		case 0xFF:
+			s = append(s, 0)
+			i++
+		case 1:
+			return string(s), b[i+2:], nil
+		default:
+			return "", b, ErrInvalid
+		}
+	}
+	return "", b, ErrShort
+}
+
+// Append append tagged value to b. Supported types are string, []byte,
+// bool, float32, float64, time.Time, signed and unsigned integers.
+// Signed and unsigned integers have different tags and do not compare
+// with each other
+func Append(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return AppendString(append(b, tagString), v), nil
+	case []byte:
+		return AppendString(append(b, tagString), string(v)), nil
+	case bool:
+		if v {
+			return append(b, tagTrue), nil
+		}
+		return append(b, tagFalse), nil
+	case int:
+		return AppendInt(append(b, tagInt), int64(v)), nil
+	case int8:
+		return AppendInt(append(b, tagInt), int64(v)), nil
+	case int16:
+		return AppendInt(append(b, tagInt), int64(v)), nil
+	case int32:
+		return AppendInt(append(b, tagInt), int64(v)), nil
+	case int64:
+		return AppendInt(append(b, tagInt), v), nil
+	case uint:
+		return AppendUint(append(b, tagUint), uint64(v)), nil
+	case uint8:
+		return AppendUint(append(b, tagUint), uint64(v)), nil
+	case uint16:
+		return AppendUint(append(b, tagUint), uint64(v)), nil
+	case uint32:
+		return AppendUint(append(b, tagUint), uint64(v)), nil
+	case uint64:
+		return AppendUint(append(b, tagUint), v), nil
+	case float32:
+		return AppendFloat(append(b, tagFloat), float64(v)), nil
+	case float64:
+		return AppendFloat(append(b, tagFloat), v), nil
+	case time.Time:
+		return AppendTime(append(b, tagTime), v), nil
+	}
+	return b, fmt.Errorf("keyenc: unsupported type %T", v)
+}
+
+// Tuple encode values with Append into a key
+func Tuple(values ...interface{}) (string, error) {
+	var b []byte
+	var err error
+	for _, v := range values {
+		if b, err = Append(b, v); err != nil {
+			return "", err
+		}
+	}
+	return string(b), nil
+}
+
+// MustTuple is like Tuple but panics on unsupported type
+func MustTuple(values ...interface{}) string {
+	key, err := Tuple(values...)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// DecodeTuple decode key encoded with Tuple. Integers are returned as
+// int64 or uint64, floats as float64, strings as string, times in UTC
+func DecodeTuple(key string) (values []interface{}, err error) {
+	b := []byte(key)
+	for len(b) > 0 {
+		var v interface{}
+		tag := b[0]
+		b = b[1:]
+		switch tag {
+		case tagString:
+			v, b, err = DecodeString(b)
+		case tagFalse:
+			v = false
+		case tagTrue:
+			v = true
+		case tagInt:
+			v, b, err = DecodeInt(b)
+		case tagUint:
+			v, b, err = DecodeUint(b)
+		case tagFloat:
+			v, b, err = DecodeFloat(b)
+		case tagTime:
+			v, b, err = DecodeTime(b)
+		default:
+			err = ErrInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
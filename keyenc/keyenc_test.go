@@ -0,0 +1,137 @@
+package keyenc
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertSorted(t *testing.T, keys []string, less func(i, j int) bool) {
+	for i := range keys {
+		for j := range keys {
+			if less(i, j) != (keys[i] < keys[j]) {
+				t.Fatalf("order mismatch %d %d: %x %x", i, j, keys[i], keys[j])
+			}
+		}
+	}
+}
+
+func TestInt(t *testing.T) {
+	values := []int64{math.MinInt64, -1 << 40, -256, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt64}
+	for i := 0; i < 50; i++ {
+		values = append(values, rand.Int63()-rand.Int63())
+	}
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = string(AppendInt(nil, v))
+		d, rest, err := DecodeInt([]byte(keys[i]))
+		assert.NoError(t, err)
+		assert.Equal(t, v, d)
+		assert.Empty(t, rest)
+	}
+	assertSorted(t, keys, func(i, j int) bool { return values[i] < values[j] })
+}
+
+func TestFloat(t *testing.T) {
+	values := []float64{math.Inf(-1), -math.MaxFloat64, -1e10, -1.5, -math.SmallestNonzeroFloat64,
+		0, math.SmallestNonzeroFloat64, 0.1, 1, 1e300, math.Inf(1)}
+	for i := 0; i < 50; i++ {
+		values = append(values, rand.NormFloat64()*1e6)
+	}
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = string(AppendFloat(nil, v))
+		d, _, err := DecodeFloat([]byte(keys[i]))
+		assert.NoError(t, err)
+		assert.Equal(t, v, d)
+	}
+	assertSorted(t, keys, func(i, j int) bool { return values[i] < values[j] })
+}
+
+func TestTime(t *testing.T) {
+	base := time.Date(2020, 8, 14, 0, 0, 0, 0, time.UTC)
+	values := []time.Time{time.Unix(-1, 999), time.Unix(0, 0), base, base.Add(time.Nanosecond), base.Add(time.Hour)}
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = string(AppendTime(nil, v))
+		d, _, err := DecodeTime([]byte(keys[i]))
+		assert.NoError(t, err)
+		assert.True(t, v.Equal(d))
+	}
+	assertSorted(t, keys, func(i, j int) bool { return values[i].Before(values[j]) })
+}
+
+func TestString(t *testing.T) {
+	values := []string{"", "\x00", "\x00\x00", "\x00\x01", "a", "a\x00", "a\x00b", "a\x01", "ab", "b", "\xff"}
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = string(AppendString(nil, v))
+		d, rest, err := DecodeString(append([]byte(keys[i]), 'x'))
+		assert.NoError(t, err)
+		assert.Equal(t, v, d)
+		assert.Equal(t, []byte("x"), rest)
+	}
+	assertSorted(t, keys, func(i, j int) bool { return values[i] < values[j] })
+
+	_, _, err := DecodeString([]byte("ab"))
+	assert.Equal(t, ErrShort, err)
+	_, _, err = DecodeString([]byte("a\x00\x02"))
+	assert.Equal(t, ErrInvalid, err)
+}
+
+func TestTuple(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	key := MustTuple("tenant", ts, int64(-42), uint64(7), 1.5, true, false, []byte("id\x00"))
+	values, err := DecodeTuple(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"tenant", ts, int64(-42), uint64(7), 1.5, true, false, "id\x00"}, values)
+
+	_, err = Tuple(struct{}{})
+	assert.Error(t, err)
+	_, err = DecodeTuple("\x99")
+	assert.Equal(t, ErrInvalid, err)
+
+	type row struct {
+		tenant string
+		ts     int64
+		id     int
+	}
+	var rows []row
+	for _, tenant := range []string{"a", "a\x00", "ab", "b"} {
+		for _, ts := range []int64{-5, 0, 3} {
+			for _, id := range []int{-1, 0, 10} {
+				rows = append(rows, row{tenant, ts, id})
+			}
+		}
+	}
+	rand.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		keys[i] = MustTuple(r.tenant, time.Unix(r.ts, 0), r.id)
+	}
+	assertSorted(t, keys, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.tenant != b.tenant {
+			return a.tenant < b.tenant
+		}
+		if a.ts != b.ts {
+			return a.ts < b.ts
+		}
+		return a.id < b.id
+	})
+
+	// tuple is a prefix of longer tuples
+	prefix := MustTuple("a")
+	n := 0
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+			n++
+		}
+	}
+	assert.Equal(t, 9, n)
+}
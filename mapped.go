@@ -0,0 +1,336 @@
+package sortedset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// MappedSet is a read-only set queried in place from snapshot file.
+// File is mapped in memory, pages are read by OS on access and shared
+// between processes. It's safe for concurrent use, but must not be used
+// after Close
+type MappedSet struct {
+	data  []byte
+	index []byte
+	pages int
+	count int
+	flags uint32
+	unmap func() error
+}
+
+// OpenSnapshot map snapshot file written by SaveSnapshot or WriteSnapshot.
+// Open check file structure and key offsets, Validate check order of keys
+func OpenSnapshot(path string) (*MappedSet, error) {
+	return openMapped(path, 0)
+}
+
+// openMapped map file with given flags
+func openMapped(path string, flags uint32) (*MappedSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < headerSize+trailerSize {
+		return nil, ErrCorrupt
+	}
+	data, unmap, err := mmapFile(f, int(st.Size()))
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedSet{data: data, unmap: unmap}
+	if err := m.open(flags); err != nil {
+		unmap()
+		return nil, err
+	}
+	return m, nil
+}
+
+// open parse header, trailer and index
+func (m *MappedSet) open(flags uint32) error {
+	data := m.data
+	trailer := data[len(data)-trailerSize:]
+	if string(data[:8]) != snapshotMagic || string(trailer[24:]) != snapshotEndMagic {
+		return ErrCorrupt
+	}
+	m.flags = binary.LittleEndian.Uint32(data[8:])
+	if m.flags != flags || binary.LittleEndian.Uint32(trailer[12:]) != m.flags {
+		return ErrCorrupt
+	}
+	indexOffset := binary.LittleEndian.Uint64(trailer)
+	m.pages = int(binary.LittleEndian.Uint32(trailer[8:]))
+	m.count = int(binary.LittleEndian.Uint64(trailer[16:]))
+	end := uint64(len(data) - trailerSize)
+	if indexOffset < headerSize || indexOffset > end || end-indexOffset != uint64(m.pages)*indexEntrySize {
+		return ErrCorrupt
+	}
+	m.index = data[indexOffset:end]
+
+	// pages follow each other from header to index
+	count := 0
+	next := uint64(headerSize)
+	for i := 0; i < m.pages; i++ {
+		off, n := m.entry(i)
+		if off != next || n == 0 || off+4+4*uint64(n+1) > indexOffset {
+			return ErrCorrupt
+		}
+		if int(binary.LittleEndian.Uint32(data[off:])) != n {
+			return ErrCorrupt
+		}
+		next = off + uint64(binary.LittleEndian.Uint32(data[off+4+4*uint64(n):]))
+		if next > indexOffset || !m.checkOffsets(off, n) {
+			return ErrCorrupt
+		}
+		count += n
+	}
+	if next != indexOffset || count != m.count {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// checkOffsets report whether key offsets of page at off are in order and
+// inside of page, so key never read out of file. Key of store run start
+// with kind byte
+func (m *MappedSet) checkOffsets(off uint64, n int) bool {
+	offsets := m.data[off+4 : off+4+4*uint64(n+1)]
+	prev := uint32(len(offsets) + 4)
+	min := uint32(0)
+	if m.flags&flagKinds != 0 {
+		min = 1
+	}
+	for i := 0; i <= n; i++ {
+		o := binary.LittleEndian.Uint32(offsets[4*i:])
+		if o < prev || (i > 0 && o-prev < min) {
+			return false
+		}
+		prev = o
+	}
+	return true
+}
+
+// entry return page offset and number of keys from index
+func (m *MappedSet) entry(i int) (offset uint64, n int) {
+	e := m.index[i*indexEntrySize:]
+	return binary.LittleEndian.Uint64(e), int(binary.LittleEndian.Uint32(e[8:]))
+}
+
+// numItems return number of keys in page
+func (m *MappedSet) numItems(i int) int {
+	_, n := m.entry(i)
+	return n
+}
+
+// key return key at i in page without copy, it points into mapped file
+func (m *MappedSet) key(idxPage, idxItem int) string {
+	off, _ := m.entry(idxPage)
+	offsets := m.data[off+4+4*uint64(idxItem):]
+	start := binary.LittleEndian.Uint32(offsets)
+	end := binary.LittleEndian.Uint32(offsets[4:])
+	if m.flags&flagKinds != 0 {
+		start++
+	}
+	if start >= end {
+		return ""
+	}
+	return unsafe.String(&m.data[off+uint64(start)], end-start)
+}
+
+// deleted report whether key at position is a delete entry of store run
+func (m *MappedSet) deleted(idxPage, idxItem int) bool {
+	if m.flags&flagKinds == 0 {
+		return false
+	}
+	off, _ := m.entry(idxPage)
+	start := binary.LittleEndian.Uint32(m.data[off+4+4*uint64(idxItem):])
+	return m.data[off+uint64(start)] == kindDel
+}
+
+// search return position of the first key (in descending order) for which f
+// is true, same as SortedSet search
+func (m *MappedSet) search(f func(key string) bool) (idxPage, idxItem int) {
+	idxPage = sort.Search(m.pages, func(n int) bool {
+		return f(m.key(n, m.numItems(n)-1))
+	})
+	if idxPage == m.pages {
+		return idxPage, 0
+	}
+	idxItem = sort.Search(m.numItems(idxPage), func(n int) bool {
+		return f(m.key(idxPage, n))
+	})
+	return idxPage, idxItem
+}
+
+// at return key at position without copy, false if position is out of set
+func (m *MappedSet) at(idxPage, idxItem int) (string, bool) {
+	if idxPage < 0 || idxPage >= m.pages || idxItem < 0 || idxItem >= m.numItems(idxPage) {
+		return "", false
+	}
+	return m.key(idxPage, idxItem), true
+}
+
+// step move position to the next smaller key, or to the next greater key
+// in ascending order
+func (m *MappedSet) step(idxPage, idxItem int, order Order) (int, int) {
+	if order == Ascending {
+		if idxItem > 0 {
+			return idxPage, idxItem - 1
+		}
+		if idxPage > 0 && idxPage <= m.pages {
+			return idxPage - 1, m.numItems(idxPage-1) - 1
+		}
+		return -1, 0
+	}
+	if idxItem+1 < m.numItems(idxPage) {
+		return idxPage, idxItem + 1
+	}
+	return idxPage + 1, 0
+}
+
+// Len return number of keys
+func (m *MappedSet) Len() int {
+	return m.count
+}
+
+// Has return true if key in set
+func (m *MappedSet) Has(key string) bool {
+	k, ok := m.at(m.search(func(k string) bool {
+		return k <= key
+	}))
+	return ok && k == key
+}
+
+// Keys return all keys in descending order, keys are copied to heap
+func (m *MappedSet) Keys() []string {
+	result := make([]string, 0, m.count)
+	for i := 0; i < m.pages; i++ {
+		for j := 0; j < m.numItems(i); j++ {
+			result = append(result, strings.Clone(m.key(i, j)))
+		}
+	}
+	return result
+}
+
+// Range call fn for keys >= from and < to in order, until fn return false.
+// Empty to means no upper bound
+func (m *MappedSet) Range(from, to string, order Order, fn func(key string) bool) {
+	for idxPage, idxItem := rangeStart(m, from, to, order); ; idxPage, idxItem = m.step(idxPage, idxItem, order) {
+		key, ok := m.at(idxPage, idxItem)
+		if !ok || key < from || (to != "" && key >= to) {
+			return
+		}
+		if !fn(strings.Clone(key)) {
+			return
+		}
+	}
+}
+
+// Stats return summary of snapshot pages, Fill is keys to capacity
+// of pages as large as the largest one
+func (m *MappedSet) Stats() Stats {
+	st := Stats{Keys: m.count, Pages: m.pages}
+	for i := 0; i < m.pages; i++ {
+		off, n := m.entry(i)
+		end := binary.LittleEndian.Uint32(m.data[off+4+4*uint64(n):])
+		start := uint32(4 + 4*(n+1))
+		st.Bytes += int(end - start)
+		if m.flags&flagKinds != 0 {
+			st.Bytes -= n
+		}
+		if i == 0 || n < st.MinItems {
+			st.MinItems = n
+		}
+		if n > st.MaxItems {
+			st.MaxItems = n
+		}
+	}
+	if st.Pages > 0 {
+		st.Fill = float64(st.Keys) / float64(st.Pages*st.MaxItems)
+	}
+	return st
+}
+
+// Validate check every page and key of snapshot
+func (m *MappedSet) Validate() error {
+	prev := ""
+	for i := 0; i < m.pages; i++ {
+		off, n := m.entry(i)
+		offsets := m.data[off+4:]
+		size := binary.LittleEndian.Uint32(offsets[4*n:])
+		last := uint32(4 + 4*(n+1))
+		for j := 0; j <= n; j++ {
+			o := binary.LittleEndian.Uint32(offsets[4*j:])
+			if o < last || o > size || (j > 0 && m.flags&flagKinds != 0 && o == last) {
+				return fmt.Errorf("sortedset: snapshot page %d key %d offset %d out of page", i, j, o)
+			}
+			last = o
+		}
+		for j := 0; j < n; j++ {
+			key := m.key(i, j)
+			if (i > 0 || j > 0) && prev <= key {
+				return fmt.Errorf("sortedset: snapshot page %d not descending at item %d: %q <= %q", i, j, prev, key)
+			}
+			prev = key
+		}
+	}
+	return nil
+}
+
+// Close unmap file
+func (m *MappedSet) Close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	*m = MappedSet{}
+	return err
+}
+
+// MappedCursor iterate over MappedSet in both directions.
+// First is the smallest key, Next move to greater key
+type MappedCursor struct {
+	c pageCursor
+}
+
+// Cursor return cursor, it's not positioned until First, Last or Seek
+func (m *MappedSet) Cursor() *MappedCursor {
+	return &MappedCursor{c: pageCursor{ix: m, idxPage: -1, copyKeys: true}}
+}
+
+// First move to the smallest key, false if set is empty
+func (c *MappedCursor) First() bool {
+	return c.c.first()
+}
+
+// Last move to the greatest key, false if set is empty
+func (c *MappedCursor) Last() bool {
+	return c.c.last()
+}
+
+// Seek move to the first key >= key, false if there is no such key
+func (c *MappedCursor) Seek(key string) bool {
+	return c.c.seek(key)
+}
+
+// Next move to the next greater key, false at the end
+func (c *MappedCursor) Next() bool {
+	return c.c.next()
+}
+
+// Prev move to the next smaller key, false at the end
+func (c *MappedCursor) Prev() bool {
+	return c.c.prev()
+}
+
+// Key return key at cursor, key is copied and stay valid after Close
+func (c *MappedCursor) Key() string {
+	return c.c.key
+}
@@ -0,0 +1,254 @@
+package sortedset
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Iterator walk keys matching a pattern in set order.
+// Every Next seek after the last visited key, so iterator is safe
+// to use while set is modified
+type Iterator struct {
+	set     *SortedSet
+	name    string // bucket name, trimmed from keys
+	prefix  string // bucket name + literal prefix of pattern
+	match   func(key string) bool
+	limit   int
+	n       int
+	last    string
+	key     string
+	started bool
+	done    bool
+}
+
+// Match return iterator over keys matching glob pattern, like Redis SCAN MATCH.
+// '*' match any sequence of bytes, '?' match any single byte, [abc] match one
+// byte from class, [^abc] - not from class, [a-z] - range, '\' escape next byte.
+// if limit <= 0 - no limit
+func (set *SortedSet) Match(pattern string, limit int) *Iterator {
+	return Bucket(set, "").Match(pattern, limit)
+}
+
+// MatchRegexp return iterator over keys matching re.
+// if limit <= 0 - no limit
+func (set *SortedSet) MatchRegexp(re *regexp.Regexp, limit int) *Iterator {
+	return Bucket(set, "").MatchRegexp(re, limit)
+}
+
+// Match return iterator over bucket keys matching glob pattern,
+// see SortedSet.Match
+func (bkt *BucketStore) Match(pattern string, limit int) *Iterator {
+	return bkt.iterator(globPrefix(pattern), func(key string) bool {
+		return globMatch(pattern, key)
+	}, limit)
+}
+
+// MatchRegexp return iterator over bucket keys matching re.
+// Only regexps anchored with ^ use literal prefix to skip pages
+func (bkt *BucketStore) MatchRegexp(re *regexp.Regexp, limit int) *Iterator {
+	return bkt.iterator(regexpPrefix(re), re.MatchString, limit)
+}
+
+func (bkt *BucketStore) iterator(prefix string, match func(key string) bool, limit int) *Iterator {
+	return &Iterator{
+		set:    bkt.Set,
+		name:   bkt.Name,
+		prefix: bkt.Name + prefix,
+		match:  match,
+		limit:  limit,
+	}
+}
+
+// Next move iterator to the next matching key, return false if there are no more keys
+func (it *Iterator) Next() bool {
+	if it.done || (it.limit > 0 && it.n >= it.limit) {
+		it.done = true
+		return false
+	}
+	it.set.RLock()
+	defer it.set.RUnlock()
+	set := it.set
+	order := set.opts.order
+	var idxPage, idxItem int
+	if it.started {
+		idxPage, idxItem = set.seekPrefix(it.prefix, it.last, true, order)
+	} else {
+		idxPage, idxItem = set.seekPrefix(it.prefix, "", false, order)
+		it.started = true
+	}
+	for {
+		key, ok := set.at(idxPage, idxItem)
+		if !ok || !strings.HasPrefix(key, it.prefix) {
+			it.done = true
+			it.key = ""
+			return false
+		}
+		it.last = key
+		if it.match(key[len(it.name):]) {
+			it.key = key[len(it.name):]
+			it.n++
+			return true
+		}
+		idxPage, idxItem = set.step(idxPage, idxItem, order)
+	}
+}
+
+// After move iterator after key, Next return the first matching key after it
+// in set order. Key is without bucket name, it's used to resume iteration
+// from the last returned key, like SCAN cursor
+func (it *Iterator) After(key string) *Iterator {
+	key = it.name + key
+	it.started, it.done, it.last = true, false, key
+	if !strings.HasPrefix(key, it.prefix) {
+		// keys with prefix are all after key or all before it
+		ahead := key < it.prefix
+		if it.set.opts.order == Descending {
+			ahead = key > it.prefix
+		}
+		it.started = false
+		it.done = !ahead
+	}
+	return it
+}
+
+// Key return current key
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+// Keys return all remaining keys
+func (it *Iterator) Keys() (result []string) {
+	for it.Next() {
+		result = append(result, it.Key())
+	}
+	return result
+}
+
+// globPrefix return literal prefix of glob pattern
+func globPrefix(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return b.String()
+		case '\\':
+			if i+1 == len(pattern) {
+				return b.String()
+			}
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// globMatch report whether s match glob pattern
+func globMatch(pattern, s string) bool {
+	// position to retry on mismatch after last star
+	starP, starS := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starS = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if n, ok := globClass(pattern[p:], s[i]); n > 0 {
+					if ok {
+						p += n
+						i++
+						continue
+					}
+				} else if s[i] == '[' {
+					// unterminated class is literal
+					p++
+					i++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == s[i] {
+					p += 2
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, i = starP+1, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// globClass match c against class at the start of pattern,
+// return class length (0 if class is not terminated) and match result
+func globClass(pattern string, c byte) (int, bool) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '^' || pattern[i] == '!') {
+		negate = true
+		i++
+	}
+	match := false
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return i + 1, match != negate
+		}
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= c && c <= hi {
+			match = true
+		}
+		i++
+	}
+	return 0, false
+}
+
+// regexpPrefix return literal prefix of regexp anchored at the beginning of text
+func regexpPrefix(re *regexp.Regexp) string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	if parsed.Op != syntax.OpConcat || len(parsed.Sub) < 2 || parsed.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	literal := parsed.Sub[1]
+	if literal.Op != syntax.OpLiteral || literal.Flags&syntax.FoldCase != 0 {
+		return ""
+	}
+	return string(literal.Rune)
+}
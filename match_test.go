@@ -0,0 +1,129 @@
+package sortedset
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlob(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*", "abc", true},
+		{"a*c", "abc", true},
+		{"a*c", "abcd", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"[abc]x", "bx", true},
+		{"[^abc]x", "bx", false},
+		{"[!abc]x", "dx", true},
+		{"[a-c]x", "cx", true},
+		{"[c-a]x", "bx", true},
+		{"[a-c]x", "dx", false},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"a[", "a[", true},
+		{"order:2024-*:paid", "order:2024-01-02:paid", true},
+		{"order:2024-*:paid", "order:2024-01-02:new", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, globMatch(c.pattern, c.s), "%q %q", c.pattern, c.s)
+	}
+	assert.Equal(t, "order:2024-", globPrefix("order:2024-*:paid"))
+	assert.Equal(t, "a*b", globPrefix("a\\*b?"))
+	assert.Equal(t, "", globPrefix("[a]"))
+}
+
+func TestRegexpPrefix(t *testing.T) {
+	assert.Equal(t, "order:", regexpPrefix(regexp.MustCompile(`^order:\d+`)))
+	assert.Equal(t, "", regexpPrefix(regexp.MustCompile(`order:\d+`)))
+	assert.Equal(t, "", regexpPrefix(regexp.MustCompile(`(?i)^order`)))
+	assert.Equal(t, "", regexpPrefix(regexp.MustCompile(`(?m)^order`)))
+}
+
+func TestMatch(t *testing.T) {
+	set := New()
+	orders := Bucket(set, "order:")
+	for day := 1; day <= 300; day++ {
+		status := "new"
+		if day%3 == 0 {
+			status = "paid"
+		}
+		orders.Put(fmt.Sprintf("2024-%03d:%s", day, status))
+		orders.Put(fmt.Sprintf("2023-%03d:%s", day, status))
+	}
+	set.Put("zzz:2024-001:paid")
+
+	keys := orders.Match("2024-*:paid", 0).Keys()
+	assert.Equal(t, 100, len(keys))
+	assert.Equal(t, "2024-300:paid", keys[0])
+	assert.Equal(t, "2024-003:paid", keys[99])
+
+	keys = orders.Match("2024-*:paid", 3).Keys()
+	assert.Equal(t, []string{"2024-300:paid", "2024-297:paid", "2024-294:paid"}, keys)
+
+	keys = set.Match("*:2024-001:paid", 0).Keys()
+	assert.Equal(t, []string{"zzz:2024-001:paid"}, keys)
+
+	keys = orders.MatchRegexp(regexp.MustCompile(`^2023-0[0-4]\d:paid$`), 0).Keys()
+	assert.Equal(t, 16, len(keys))
+
+	keys = set.MatchRegexp(regexp.MustCompile(`-150:`), 0).Keys()
+	assert.Equal(t, []string{"order:2024-150:paid", "order:2023-150:paid"}, keys)
+
+	// set modified while iterating
+	it := orders.Match("2024-1*", 0)
+	assert.True(t, it.Next())
+	assert.Equal(t, "2024-199:new", it.Key())
+	set.Delete("order:2024-198:paid")
+	assert.True(t, it.Next())
+	assert.Equal(t, "2024-197:new", it.Key())
+	assert.Equal(t, 97, len(it.Keys()))
+	assert.False(t, it.Next())
+}
+
+func TestMatchEmptyKey(t *testing.T) {
+	for _, order := range []Order{Descending, Ascending} {
+		set := New(WithOrder(order))
+		for _, key := range []string{"", "a", "b"} {
+			set.Put(key)
+		}
+		want := []string{"b", "a", ""}
+		if order == Ascending {
+			want = []string{"", "a", "b"}
+		}
+		assert.Equal(t, want, set.Match("*", 0).Keys())
+		assert.Equal(t, []string{""}, set.MatchRegexp(regexp.MustCompile("^$"), 0).Keys())
+	}
+}
+
+func TestIteratorAfter(t *testing.T) {
+	for _, order := range []Order{Descending, Ascending} {
+		set := New(WithPageSize(4), WithOrder(order))
+		for i := 0; i < 30; i++ {
+			set.Put(fmt.Sprintf("k%02d", i))
+		}
+		start, want := "k19", []string{"k18", "k17", "k16"}
+		if order == Ascending {
+			start, want = "k10", []string{"k11", "k12", "k13"}
+		}
+		assert.Equal(t, want, set.Match("k1*", 3).After(start).Keys())
+		// key out of pattern prefix, before or after its keys
+		before, after := "k2", "k0"
+		if order == Ascending {
+			before, after = after, before
+		}
+		assert.Equal(t, 10, len(set.Match("k1*", 0).After(before).Keys()))
+		assert.Empty(t, set.Match("k1*", 0).After(after).Keys())
+		// bucket keys are without bucket name
+		assert.Equal(t, []string{want[1][1:], want[2][1:]}, Bucket(set, "k").Match("1*", 2).After(want[0][1:]).Keys())
+	}
+}
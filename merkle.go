@@ -0,0 +1,411 @@
+package sortedset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// Summary of keys in range. Hash is sum of key hashes, so summary of range
+// is sum of summaries of its parts and of pages inside it, it's a Merkle
+// tree over key space with any split points. Hash don't depend on page
+// layout, sets with the same keys have the same summaries
+type Summary struct {
+	Count int
+	Hash  uint64
+}
+
+// KeyRange is a range of keys >= From and < To, empty To means no upper bound
+type KeyRange struct {
+	From string
+	To   string
+}
+
+// keyHash is stable between processes, it's FNV-1a mixed by splitmix64
+// finalizer, so sums of hashes change in all bits
+func keyHash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// Summary return number and hash of keys >= from and < to, empty to means
+// no upper bound. Full pages of range are summed without reading keys
+func (set *SortedSet) Summary(from, to string) Summary {
+	set.RLock()
+	defer set.RUnlock()
+	return set.summary(from, to)
+}
+
+// span return positions of the greatest key of range and of the first key
+// after range in descending order
+func (set *SortedSet) span(from, to string) (hiPage, hiItem, loPage, loItem int) {
+	if to != "" {
+		hiPage, hiItem = set.search(func(key string) bool {
+			return key < to
+		})
+	}
+	loPage, loItem = set.search(func(key string) bool {
+		return key < from
+	})
+	return
+}
+
+func (set *SortedSet) summary(from, to string) (s Summary) {
+	if to != "" && from >= to {
+		return s
+	}
+	hiPage, hiItem, loPage, loItem := set.span(from, to)
+	for i := hiPage; i <= loPage && i < len(set.pages); i++ {
+		p := set.pages[i]
+		first, last := 0, p.numItems
+		if i == hiPage {
+			first = hiItem
+		}
+		if i == loPage {
+			last = loItem
+		}
+		if first == 0 && last == p.numItems {
+			s.Count += p.numItems
+			s.Hash += p.sum
+			continue
+		}
+		for j := first; j < last; j++ {
+			s.Count++
+			s.Hash += keyHash(p.key(j))
+		}
+	}
+	return s
+}
+
+// splitRange split range with count keys to parts with about the same
+// number of keys, return bounds in ascending order
+func (set *SortedSet) splitRange(from, to string, count, parts int) []string {
+	set.RLock()
+	defer set.RUnlock()
+	idxPage, idxItem, _, _ := set.span(from, to)
+	bounds := make([]string, parts-1)
+	offset := 0
+	for j := 1; j < parts; j++ {
+		// move by k keys in descending order
+		k := count*j/parts - offset
+		offset += k
+		for idxPage < len(set.pages) && idxItem+k >= set.pages[idxPage].numItems {
+			k -= set.pages[idxPage].numItems - idxItem
+			idxPage, idxItem = idxPage+1, 0
+		}
+		idxItem += k
+		key, ok := set.at(idxPage, idxItem)
+		if !ok {
+			// set changed since count
+			return bounds[parts-j:]
+		}
+		bounds[parts-1-j] = key
+	}
+	return bounds
+}
+
+// DiffPeer is other copy of set for Diff. It may be local set, see Peer,
+// or set in other process, see NewDiffClient
+type DiffPeer interface {
+	// Summaries return summary of every range
+	Summaries(ranges []KeyRange) ([]Summary, error)
+	// RangeKeys return keys of every range in ascending order
+	RangeKeys(ranges []KeyRange) ([][]string, error)
+}
+
+const (
+	diffFanout = 16
+	diffLeaf   = 64 // ranges with less keys are compared key by key
+)
+
+// Diff compare set with peer top-down: summaries of differing ranges are
+// requested level by level, keys only for small differing ranges.
+// It return keys which are only in set and keys which are only in peer,
+// in ascending order. Sets changed during Diff give approximate result
+func (set *SortedSet) Diff(peer DiffPeer) (local, remote []string, err error) {
+	ranges := []KeyRange{{}}
+	for len(ranges) > 0 {
+		summaries, err := peer.Summaries(ranges)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(summaries) != len(ranges) {
+			return nil, nil, ErrReplication
+		}
+		var next, leaves []KeyRange
+		for i, r := range ranges {
+			s := set.Summary(r.From, r.To)
+			switch {
+			case s == summaries[i]:
+			case s.Count <= diffLeaf || summaries[i].Count <= diffLeaf:
+				leaves = append(leaves, r)
+			default:
+				bounds := set.splitRange(r.From, r.To, s.Count, diffFanout)
+				from := r.From
+				for _, b := range bounds {
+					next = append(next, KeyRange{From: from, To: b})
+					from = b
+				}
+				next = append(next, KeyRange{From: from, To: r.To})
+			}
+		}
+		if len(leaves) > 0 {
+			keys, err := peer.RangeKeys(leaves)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(keys) != len(leaves) {
+				return nil, nil, ErrReplication
+			}
+			for i, r := range leaves {
+				local, remote = mergeDiff(set.rangeAscending(r), keys[i], local, remote)
+			}
+		}
+		ranges = next
+	}
+	sort.Strings(local)
+	sort.Strings(remote)
+	return local, remote, nil
+}
+
+func (set *SortedSet) rangeAscending(r KeyRange) (keys []string) {
+	set.Range(r.From, r.To, Ascending, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// mergeDiff append keys only in a to onlyA and keys only in b to onlyB,
+// a and b are ascending
+func mergeDiff(a, b, onlyA, onlyB []string) ([]string, []string) {
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			onlyA, a = append(onlyA, a[0]), a[1:]
+		case a[0] > b[0]:
+			onlyB, b = append(onlyB, b[0]), b[1:]
+		default:
+			a, b = a[1:], b[1:]
+		}
+	}
+	return append(onlyA, a...), append(onlyB, b...)
+}
+
+// Peer return set as DiffPeer, to compare sets in one process
+func (set *SortedSet) Peer() DiffPeer {
+	return localPeer{set}
+}
+
+type localPeer struct {
+	set *SortedSet
+}
+
+func (p localPeer) Summaries(ranges []KeyRange) ([]Summary, error) {
+	result := make([]Summary, len(ranges))
+	for i, r := range ranges {
+		result[i] = p.set.Summary(r.From, r.To)
+	}
+	return result, nil
+}
+
+func (p localPeer) RangeKeys(ranges []KeyRange) ([][]string, error) {
+	result := make([][]string, len(ranges))
+	for i, r := range ranges {
+		result[i] = p.set.rangeAscending(r)
+	}
+	return result, nil
+}
+
+// Diff requests and replies are replication frames with seq 0:
+//
+//	summaries  request: uvarint number of ranges, every range is from and to
+//	           as uvarint length and bytes; reply: uvarint count and
+//	           hash uint64 for every range
+//	keys       request: ranges like summaries; reply: for every range
+//	           uvarint number of keys, every key as uvarint length and bytes
+const (
+	frameSummaries = frameDel + 1 + iota
+	frameRangeKeys
+)
+
+// ServeDiff answer requests of DiffClient from rw until it close
+// connection, then return nil
+func (set *SortedSet) ServeDiff(rw io.ReadWriter) error {
+	r := bufio.NewReader(rw)
+	w := bufio.NewWriter(rw)
+	peer := localPeer{set}
+	for {
+		kind, _, payload, err := readFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		d := frameDecoder{b: payload}
+		ranges := make([]KeyRange, d.count())
+		for i := range ranges {
+			ranges[i] = KeyRange{From: d.string(), To: d.string()}
+		}
+		if d.err != nil {
+			return d.err
+		}
+		var b []byte
+		switch kind {
+		case frameSummaries:
+			summaries, _ := peer.Summaries(ranges)
+			for _, s := range summaries {
+				b = binary.AppendUvarint(b, uint64(s.Count))
+				b = binary.LittleEndian.AppendUint64(b, s.Hash)
+			}
+		case frameRangeKeys:
+			keys, _ := peer.RangeKeys(ranges)
+			for _, rk := range keys {
+				b = binary.AppendUvarint(b, uint64(len(rk)))
+				for _, key := range rk {
+					b = appendString(b, key)
+				}
+			}
+		default:
+			return ErrReplication
+		}
+		if err := writeFrame(w, kind, 0, b); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// DiffClient is DiffPeer for set served by ServeDiff in other process.
+// It's not safe for concurrent use
+type DiffClient struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewDiffClient create DiffPeer which send requests to rw
+func NewDiffClient(rw io.ReadWriter) *DiffClient {
+	return &DiffClient{r: bufio.NewReader(rw), w: bufio.NewWriter(rw)}
+}
+
+// call send ranges and return reply payload
+func (c *DiffClient) call(kind byte, ranges []KeyRange) (*frameDecoder, error) {
+	b := binary.AppendUvarint(nil, uint64(len(ranges)))
+	for _, r := range ranges {
+		b = appendString(appendString(b, r.From), r.To)
+	}
+	if err := writeFrame(c.w, kind, 0, b); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	reply, _, payload, err := readFrame(c.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if reply != kind {
+		return nil, ErrReplication
+	}
+	return &frameDecoder{b: payload}, nil
+}
+
+// Summaries implement DiffPeer
+func (c *DiffClient) Summaries(ranges []KeyRange) ([]Summary, error) {
+	d, err := c.call(frameSummaries, ranges)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Summary, len(ranges))
+	for i := range result {
+		result[i] = Summary{Count: int(d.uvarint()), Hash: d.uint64()}
+	}
+	return result, d.err
+}
+
+// RangeKeys implement DiffPeer
+func (c *DiffClient) RangeKeys(ranges []KeyRange) ([][]string, error) {
+	d, err := c.call(frameRangeKeys, ranges)
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]string, len(ranges))
+	for i := range result {
+		n := d.count()
+		for j := uint64(0); j < n && d.err == nil; j++ {
+			result[i] = append(result[i], d.string())
+		}
+	}
+	return result, d.err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// frameDecoder read payload of frame, the first error is kept in err
+type frameDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *frameDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count read length of string or list, every item take at least one byte
+func (d *frameDecoder) count() uint64 {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.fail()
+		return 0
+	}
+	return n
+}
+
+func (d *frameDecoder) uint64() uint64 {
+	if len(d.b) < 8 {
+		d.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.b)
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *frameDecoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+func (d *frameDecoder) fail() {
+	if d.err == nil {
+		d.err = ErrReplication
+	}
+	d.b = nil
+}
@@ -0,0 +1,151 @@
+package sortedset
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	keys := randKeysBin(3000)
+	var root Summary
+	for _, storage := range storages {
+		for _, size := range []int{4, 64} {
+			set := New(WithPageSize(size), WithStorage(storage.storage))
+			for i, key := range keys {
+				set.Put(key)
+				if i%3 == 0 {
+					set.Delete(keys[i/2])
+				}
+			}
+			assert.NoError(t, set.Validate())
+			asc := set.Keys()
+			sort.Strings(asc)
+			for i := 0; i < 50; i++ {
+				from, to := asc[rand.Intn(len(asc))], asc[rand.Intn(len(asc))]
+				if i%5 == 0 {
+					to = ""
+				}
+				if i%7 == 0 {
+					from = from[:len(from)/2]
+				}
+				var want Summary
+				for _, key := range asc {
+					if key >= from && (to == "" || key < to) {
+						want.Count++
+						want.Hash += keyHash(key)
+					}
+				}
+				assert.Equal(t, want, set.Summary(from, to), "%s %q %q", storage.name, from, to)
+			}
+			// summary don't depend on pages
+			if root == (Summary{}) {
+				root = set.Summary("", "")
+			}
+			assert.Equal(t, root, set.Summary("", ""))
+			assert.Equal(t, set.Len(), root.Count)
+		}
+	}
+	assert.Equal(t, Summary{}, New().Summary("", ""))
+	assert.Equal(t, uint64(0), keyHash("a")+keyHash("b")-keyHash("b")-keyHash("a"))
+	assert.NotEqual(t, keyHash("ab"), keyHash("ba"))
+}
+
+// countingPeer count keys sent by peer
+type countingPeer struct {
+	DiffPeer
+	keys int
+}
+
+func (p *countingPeer) RangeKeys(ranges []KeyRange) ([][]string, error) {
+	result, err := p.DiffPeer.RangeKeys(ranges)
+	for _, keys := range result {
+		p.keys += len(keys)
+	}
+	return result, err
+}
+
+func TestDiff(t *testing.T) {
+	keys := randKeys(20000)
+	a, b := New(WithPageSize(32)), New(WithPageSize(256), WithStorage(StorageArena))
+	for _, key := range keys[:19950] {
+		a.Put(key)
+		b.Put(key)
+	}
+	var onlyA, onlyB []string
+	for i, key := range keys[19950:] {
+		if i%2 == 0 {
+			a.Put(key)
+			onlyA = append(onlyA, key)
+		} else {
+			b.Put(key)
+			onlyB = append(onlyB, key)
+		}
+	}
+	for _, key := range keys[:10] {
+		a.Delete(key)
+		onlyB = append(onlyB, key)
+	}
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+
+	peer := &countingPeer{DiffPeer: b.Peer()}
+	local, remote, err := a.Diff(peer)
+	assert.NoError(t, err)
+	assert.Equal(t, onlyA, local)
+	assert.Equal(t, onlyB, remote)
+	// only keys of small differing ranges are sent
+	assert.True(t, peer.keys < 20000/4, "%d keys", peer.keys)
+
+	local, remote, err = b.Diff(a.Peer())
+	assert.NoError(t, err)
+	assert.Equal(t, onlyB, local)
+	assert.Equal(t, onlyA, remote)
+
+	peer = &countingPeer{DiffPeer: b.Clone().Peer()}
+	local, remote, err = b.Diff(peer)
+	assert.NoError(t, err)
+	assert.Empty(t, local)
+	assert.Empty(t, remote)
+	assert.Equal(t, 0, peer.keys)
+
+	local, remote, err = New().Diff(a.Peer())
+	assert.NoError(t, err)
+	assert.Empty(t, local)
+	assert.Equal(t, a.Len(), len(remote))
+}
+
+func TestDiffClient(t *testing.T) {
+	a, b := New(), New(WithPageSize(16))
+	for i, key := range randKeysBin(5000) {
+		a.Put(key)
+		if i%100 != 0 {
+			b.Put(key)
+		}
+	}
+	b.Put("")
+	c1, c2 := net.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- b.ServeDiff(c1)
+	}()
+	local, remote, err := a.Diff(NewDiffClient(c2))
+	assert.NoError(t, err)
+	assert.Equal(t, 50, len(local))
+	assert.Equal(t, []string{""}, remote)
+	for _, key := range local {
+		assert.False(t, b.Has(key))
+	}
+	c2.Close()
+	assert.NoError(t, <-done)
+
+	d := frameDecoder{b: []byte{5, 'a'}}
+	assert.Equal(t, "", d.string())
+	assert.Equal(t, ErrReplication, d.err)
+	d = frameDecoder{b: []byte{1}}
+	d.uint64()
+	assert.Equal(t, ErrReplication, d.err)
+}
@@ -0,0 +1,222 @@
+package sortedset
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Op is an instrumented operation
+type Op int
+
+// Instrumented operations
+const (
+	OpPut Op = iota
+	OpHas
+	OpDelete
+	OpKeys
+)
+
+var opNames = [...]string{"put", "has", "delete", "keys"}
+
+func (op Op) String() string {
+	if op < 0 || int(op) >= len(opNames) {
+		return "unknown"
+	}
+	return opNames[op]
+}
+
+// Observer receive metrics from instrumented sets.
+// name is the set name given to Instrument, use it as label.
+// Observer must be safe for concurrent use.
+type Observer interface {
+	// ObserveOp called after every operation with its full duration
+	ObserveOp(name string, op Op, d time.Duration)
+	// ObserveLockWait called with time spent waiting for the set lock
+	ObserveLockWait(name string, op Op, d time.Duration)
+	// ObserveSplit called on every page split
+	ObserveSplit(name string)
+	// ObserveSize called after Put and Delete with number of keys in set
+	ObserveSize(name string, size int)
+}
+
+// Instrument attach observer to set, nil observer disable instrumentation.
+// Must be called before set is used from multiple goroutines
+func (set *SortedSet) Instrument(name string, observer Observer) {
+	set.Lock()
+	defer set.Unlock()
+	set.name = name
+	set.observer = observer
+}
+
+// Stats is a summary of set pages
+type Stats struct {
+	Keys     int     `json:"keys"`
+	Pages    int     `json:"pages"`
+	Bytes    int     `json:"bytes"`     // length of all keys
+	MinItems int     `json:"min_items"` // keys in the least filled page
+	MaxItems int     `json:"max_items"` // keys in the most filled page
+	Fill     float64 `json:"fill"`      // keys to capacity of all pages
+}
+
+// Stats return summary of set pages
+func (set *SortedSet) Stats() Stats {
+	set.RLock()
+	defer set.RUnlock()
+	st := Stats{Keys: set.count, Pages: len(set.pages), MinItems: set.pages[0].numItems}
+	capacity := 0
+	for _, p := range set.pages {
+		st.Bytes += p.bytes
+		capacity += p.size - 1
+		if p.numItems < st.MinItems {
+			st.MinItems = p.numItems
+		}
+		if p.numItems > st.MaxItems {
+			st.MaxItems = p.numItems
+		}
+	}
+	st.Fill = float64(st.Keys) / float64(capacity)
+	return st
+}
+
+func (set *SortedSet) lock(op Op) (start time.Time) {
+	if set.observer == nil {
+		set.Lock()
+		return
+	}
+	start = time.Now()
+	set.Lock()
+	set.observer.ObserveLockWait(set.name, op, time.Since(start))
+	return start
+}
+
+func (set *SortedSet) unlock(op Op, start time.Time) {
+	if set.observer == nil {
+		set.Unlock()
+		return
+	}
+	size := set.count
+	set.Unlock()
+	if op == OpPut || op == OpDelete {
+		set.observer.ObserveSize(set.name, size)
+	}
+	set.observer.ObserveOp(set.name, op, time.Since(start))
+}
+
+// unlockWrites unlock set locked by lock(OpPut) after puts and deletes
+// of transaction, they are observed like Put and Delete
+func (set *SortedSet) unlockWrites(start time.Time, puts, dels int) {
+	if set.observer == nil {
+		set.Unlock()
+		return
+	}
+	size := set.count
+	set.Unlock()
+	if puts+dels == 0 {
+		return
+	}
+	set.observer.ObserveSize(set.name, size)
+	d := time.Since(start) / time.Duration(puts+dels)
+	for i := 0; i < puts; i++ {
+		set.observer.ObserveOp(set.name, OpPut, d)
+	}
+	for i := 0; i < dels; i++ {
+		set.observer.ObserveOp(set.name, OpDelete, d)
+	}
+}
+
+func (set *SortedSet) rlock(op Op) (start time.Time) {
+	if set.observer == nil {
+		set.RLock()
+		return
+	}
+	start = time.Now()
+	set.RLock()
+	set.observer.ObserveLockWait(set.name, op, time.Since(start))
+	return start
+}
+
+func (set *SortedSet) runlock(op Op, start time.Time) {
+	set.RUnlock()
+	if set.observer != nil {
+		set.observer.ObserveOp(set.name, op, time.Since(start))
+	}
+}
+
+// ExpvarObserver publish metrics in expvar map "sortedset",
+// with a nested map for every set name:
+//
+//	put, has, delete, keys - operations count
+//	put_ns, has_ns, delete_ns, keys_ns - total operations time
+//	lock_wait_ns - total time waiting for lock
+//	splits - page splits count
+//	size - number of keys
+type ExpvarObserver struct{}
+
+var (
+	expvarOnce sync.Once
+	expvarRoot *expvar.Map
+	expvarSets sync.Map // name -> *expvarSet
+)
+
+type expvarSet struct {
+	ops      [len(opNames)]*expvar.Int
+	opsNs    [len(opNames)]*expvar.Int
+	lockWait *expvar.Int
+	splits   *expvar.Int
+	size     *expvar.Int
+}
+
+func expvarFor(name string) *expvarSet {
+	if v, ok := expvarSets.Load(name); ok {
+		return v.(*expvarSet)
+	}
+	expvarOnce.Do(func() {
+		expvarRoot = expvar.NewMap("sortedset")
+	})
+	m := new(expvar.Map).Init()
+	vars := &expvarSet{
+		lockWait: new(expvar.Int),
+		splits:   new(expvar.Int),
+		size:     new(expvar.Int),
+	}
+	for i, op := range opNames {
+		vars.ops[i] = new(expvar.Int)
+		vars.opsNs[i] = new(expvar.Int)
+		m.Set(op, vars.ops[i])
+		m.Set(op+"_ns", vars.opsNs[i])
+	}
+	m.Set("lock_wait_ns", vars.lockWait)
+	m.Set("splits", vars.splits)
+	m.Set("size", vars.size)
+	v, loaded := expvarSets.LoadOrStore(name, vars)
+	if !loaded {
+		expvarRoot.Set(name, m)
+	}
+	return v.(*expvarSet)
+}
+
+// ObserveOp implements Observer
+func (ExpvarObserver) ObserveOp(name string, op Op, d time.Duration) {
+	if op < 0 || int(op) >= len(opNames) {
+		return
+	}
+	vars := expvarFor(name)
+	vars.ops[op].Add(1)
+	vars.opsNs[op].Add(int64(d))
+}
+
+// ObserveLockWait implements Observer
+func (ExpvarObserver) ObserveLockWait(name string, op Op, d time.Duration) {
+	expvarFor(name).lockWait.Add(int64(d))
+}
+
+// ObserveSplit implements Observer
+func (ExpvarObserver) ObserveSplit(name string) {
+	expvarFor(name).splits.Add(1)
+}
+
+// ObserveSize implements Observer
+func (ExpvarObserver) ObserveSize(name string, size int) {
+	expvarFor(name).size.Set(int64(size))
+}
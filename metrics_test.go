@@ -0,0 +1,105 @@
+package sortedset
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countObserver struct {
+	sync.Mutex
+	names  map[string]bool
+	ops    map[Op]int
+	waits  int
+	splits int
+	size   int
+}
+
+func (o *countObserver) ObserveOp(name string, op Op, d time.Duration) {
+	o.Lock()
+	defer o.Unlock()
+	o.names[name] = true
+	o.ops[op]++
+}
+
+func (o *countObserver) ObserveLockWait(name string, op Op, d time.Duration) {
+	o.Lock()
+	defer o.Unlock()
+	o.waits++
+}
+
+func (o *countObserver) ObserveSplit(name string) {
+	o.Lock()
+	defer o.Unlock()
+	o.splits++
+}
+
+func (o *countObserver) ObserveSize(name string, size int) {
+	o.Lock()
+	defer o.Unlock()
+	o.size = size
+}
+
+func TestInstrument(t *testing.T) {
+	o := &countObserver{names: map[string]bool{}, ops: map[Op]int{}}
+	set := New()
+	set.Instrument("users", o)
+	for i := 0; i < 300; i++ {
+		set.Put(fmt.Sprintf("%03d", i))
+	}
+	assert.True(t, set.Has("001"))
+	assert.True(t, set.Delete("001"))
+	assert.Equal(t, 299, len(set.Keys()))
+	assert.Equal(t, 0, len(Bucket(set, "x").Keys(0, 0)))
+
+	assert.Equal(t, map[string]bool{"users": true}, o.names)
+	assert.Equal(t, 300, o.ops[OpPut])
+	assert.Equal(t, 1, o.ops[OpHas])
+	assert.Equal(t, 1, o.ops[OpDelete])
+	assert.Equal(t, 2, o.ops[OpKeys])
+	assert.Equal(t, 304, o.waits)
+	assert.Equal(t, 1, o.splits)
+	assert.Equal(t, 299, o.size)
+	assert.Equal(t, 299, set.Len())
+
+	set.Instrument("", nil)
+	set.Put("x")
+	assert.Equal(t, 300, o.ops[OpPut])
+}
+
+func TestExpvarObserver(t *testing.T) {
+	set := New()
+	set.Instrument("expvar_test", ExpvarObserver{})
+	set.Put("a")
+	set.Put("b")
+	set.Has("a")
+
+	var vars map[string]int64
+	m := expvar.Get("sortedset").(*expvar.Map).Get("expvar_test")
+	assert.NoError(t, json.Unmarshal([]byte(m.String()), &vars))
+	assert.Equal(t, int64(2), vars["put"])
+	assert.Equal(t, int64(1), vars["has"])
+	assert.Equal(t, int64(2), vars["size"])
+	assert.Equal(t, "delete", OpDelete.String())
+}
+
+func TestStats(t *testing.T) {
+	set := New(WithPageSize(4))
+	assert.Equal(t, Stats{Pages: 1}, set.Stats())
+	for _, key := range []string{"a", "bb", "c", "dd", "e"} {
+		set.Put(key)
+	}
+	st := set.Stats()
+	assert.Equal(t, 5, st.Keys)
+	assert.Equal(t, 7, st.Bytes)
+	assert.Equal(t, len(set.pages), st.Pages)
+	assert.Equal(t, 2, st.Pages)
+	assert.Equal(t, 2, st.MinItems)
+	assert.Equal(t, 3, st.MaxItems)
+	assert.InDelta(t, 5.0/float64(3*st.Pages), st.Fill, 1e-9)
+}
@@ -0,0 +1,211 @@
+package sortedset
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// MultiSet is a sorted set where every key has a count, like tags with
+// number of uses. Counts are kept in pages next to keys.
+// It's safe for concurrent use
+type MultiSet struct {
+	set   *SortedSet
+	total int // sum of counts, changed under set lock
+}
+
+// KeyCount is a key with its count
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// NewMultiSet create multiset, options are the same as for New
+func NewMultiSet(opts ...Option) *MultiSet {
+	set := New(opts...)
+	set.counted = true
+	set.pages[0].counts = make([]int, 0, set.pages[0].size)
+	return &MultiSet{set: set}
+}
+
+// find return position of key and true if key is present
+func (set *SortedSet) find(key string) (idx, i int, ok bool) {
+	idx = set.idxPage(key, false)
+	p := set.pages[idx]
+	i = p.idxItem(key)
+	return idx, i, i < p.numItems && p.key(i) == key
+}
+
+// Add add n to count of key, return new count. n <= 0 is ignored
+func (ms *MultiSet) Add(key string, n int) int {
+	set := ms.set
+	start := set.lock(OpPut)
+	defer set.unlock(OpPut, start)
+	idx, i, ok := set.find(key)
+	if n <= 0 {
+		if !ok {
+			return 0
+		}
+		return set.pages[idx].counts[i]
+	}
+	if !ok {
+		set.put(key)
+		idx, i, _ = set.find(key)
+	}
+	p := set.own(idx)
+	p.counts[i] += n
+	ms.total += n
+	return p.counts[i]
+}
+
+// Remove subtract n from count of key, key is deleted when count drop
+// to zero. Return new count, n <= 0 is ignored
+func (ms *MultiSet) Remove(key string, n int) int {
+	set := ms.set
+	start := set.lock(OpDelete)
+	defer set.unlock(OpDelete, start)
+	idx, i, ok := set.find(key)
+	if !ok {
+		return 0
+	}
+	count := set.pages[idx].counts[i]
+	if n <= 0 {
+		return count
+	}
+	if n >= count {
+		ms.total -= count
+		set.delete(key)
+		return 0
+	}
+	p := set.own(idx)
+	p.counts[i] -= n
+	ms.total -= n
+	return p.counts[i]
+}
+
+// Count return count of key, 0 if key is not present
+func (ms *MultiSet) Count(key string) int {
+	set := ms.set
+	start := set.rlock(OpHas)
+	defer set.runlock(OpHas, start)
+	idx, i, ok := set.find(key)
+	if !ok {
+		return 0
+	}
+	return set.pages[idx].counts[i]
+}
+
+// Len return number of distinct keys
+func (ms *MultiSet) Len() int {
+	return ms.set.Len()
+}
+
+// Total return sum of all counts
+func (ms *MultiSet) Total() int {
+	ms.set.RLock()
+	defer ms.set.RUnlock()
+	return ms.total
+}
+
+// Range call fn for keys >= from and < to with their counts in order,
+// until fn return false. Empty to means no upper bound.
+// fn must not modify multiset
+func (ms *MultiSet) Range(from, to string, order Order, fn func(key string, count int) bool) {
+	set := ms.set
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	for idxPage, idxItem := rangeStart(set, from, to, order); ; idxPage, idxItem = set.step(idxPage, idxItem, order) {
+		key, ok := set.at(idxPage, idxItem)
+		if !ok || key < from || (to != "" && key >= to) || !fn(key, set.pages[idxPage].counts[idxItem]) {
+			return
+		}
+	}
+}
+
+// TopByCount return n keys with the largest counts, by count descending
+// and by key ascending for equal counts
+func (ms *MultiSet) TopByCount(n int) []KeyCount {
+	if n <= 0 {
+		return nil
+	}
+	set := ms.set
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	h := make(topHeap, 0, n)
+	for _, p := range set.pages {
+		for i := 0; i < p.numItems; i++ {
+			kc := KeyCount{Key: p.key(i), Count: p.counts[i]}
+			if len(h) < n {
+				heap.Push(&h, kc)
+			} else if h.less(h[0], kc) {
+				h[0] = kc
+				heap.Fix(&h, 0)
+			}
+		}
+	}
+	sort.Slice(h, func(i, j int) bool {
+		return h.less(h[j], h[i])
+	})
+	return h
+}
+
+// topHeap is a min-heap, the worst of top keys is on top
+type topHeap []KeyCount
+
+// less report whether a is lower than b in top
+func (topHeap) less(a, b KeyCount) bool {
+	if a.Count != b.Count {
+		return a.Count < b.Count
+	}
+	return a.Key > b.Key
+}
+
+func (h topHeap) Len() int            { return len(h) }
+func (h topHeap) Less(i, j int) bool  { return h.less(h[i], h[j]) }
+func (h topHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x interface{}) { *h = append(*h, x.(KeyCount)) }
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Validate check pages and counts
+func (ms *MultiSet) Validate() error {
+	set := ms.set
+	set.RLock()
+	defer set.RUnlock()
+	if err := set.validate(); err != nil {
+		return err
+	}
+	total := 0
+	for _, p := range set.pages {
+		for _, c := range p.counts {
+			total += c
+		}
+	}
+	if total != ms.total {
+		return fmt.Errorf("sortedset: total count is %d, pages hold %d", ms.total, total)
+	}
+	return nil
+}
+
+func (set *SortedSet) checkCounts(p *page) error {
+	if !set.counted {
+		if p.counts != nil {
+			return errors.New("counts in set without counts")
+		}
+		return nil
+	}
+	if len(p.counts) != p.numItems {
+		return fmt.Errorf("%d counts for %d keys", len(p.counts), p.numItems)
+	}
+	for i, c := range p.counts {
+		if c <= 0 {
+			return fmt.Errorf("count of item %d is %d", i, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiSet(t *testing.T) {
+	keys := randKeys(300)
+	for _, storage := range storages {
+		for _, opts := range [][]Option{
+			{WithPageSize(4)},
+			{WithPageSize(16), WithAdaptivePages(4, 64), WithBloom(0.01)},
+		} {
+			ms := NewMultiSet(append(opts, WithStorage(storage.storage))...)
+			model := map[string]int{}
+			total := 0
+			for i := 0; i < 5000; i++ {
+				key := keys[rand.Intn(len(keys))]
+				n := rand.Intn(5)
+				if rand.Intn(3) == 0 {
+					got := ms.Remove(key, n)
+					if n >= model[key] {
+						total -= model[key]
+						delete(model, key)
+					} else if n > 0 {
+						model[key] -= n
+						total -= n
+					}
+					assert.Equal(t, model[key], got)
+				} else {
+					if n > 0 {
+						model[key] += n
+						total += n
+					}
+					assert.Equal(t, model[key], ms.Add(key, n))
+				}
+			}
+			assert.NoError(t, ms.Validate(), storage.name)
+			assert.Equal(t, len(model), ms.Len())
+			assert.Equal(t, total, ms.Total())
+			for _, key := range keys {
+				assert.Equal(t, model[key], ms.Count(key))
+			}
+
+			var want []KeyCount
+			for key, count := range model {
+				want = append(want, KeyCount{key, count})
+			}
+			sort.Slice(want, func(i, j int) bool {
+				return want[i].Key < want[j].Key
+			})
+			var got []KeyCount
+			ms.Range("", "", Ascending, func(key string, count int) bool {
+				got = append(got, KeyCount{key, count})
+				return true
+			})
+			assert.Equal(t, want, got)
+
+			sort.SliceStable(want, func(i, j int) bool {
+				return want[i].Count > want[j].Count
+			})
+			assert.Equal(t, want[:10], ms.TopByCount(10))
+			assert.Equal(t, want, ms.TopByCount(len(want)+5))
+		}
+	}
+}
+
+func TestMultiSetTags(t *testing.T) {
+	tags := NewMultiSet()
+	for _, tag := range []string{"go", "db", "go", "sql", "go", "db"} {
+		tags.Add(tag, 1)
+	}
+	assert.Equal(t, 3, tags.Count("go"))
+	assert.Equal(t, []KeyCount{{"go", 3}, {"db", 2}}, tags.TopByCount(2))
+	assert.Equal(t, 0, tags.Add("rust", 0))
+	assert.Equal(t, 0, tags.Count("rust"))
+	assert.Equal(t, 2, tags.Remove("db", 0))
+	assert.Equal(t, 0, tags.Remove("db", 5))
+	assert.Equal(t, 0, tags.Remove("nope", 1))
+	var got []KeyCount
+	tags.Range("a", "z", Descending, func(key string, count int) bool {
+		got = append(got, KeyCount{key, count})
+		return true
+	})
+	assert.Equal(t, []KeyCount{{"sql", 1}, {"go", 3}}, got)
+	assert.Nil(t, tags.TopByCount(0))
+	assert.Equal(t, 4, tags.Total())
+	assert.NoError(t, tags.Validate())
+
+	// plain set has no counts
+	assert.NoError(t, New().Validate())
+}
@@ -0,0 +1,194 @@
+package sortedset
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// MultiView is a read-only view of several sets or buckets as one ordered
+// set, equal keys of different sources are one key. View read sets under
+// their read locks and don't copy keys, sets may be changed between calls
+type MultiView struct {
+	sources []*BucketStore
+	sets    []*SortedSet // distinct sets in lock order
+}
+
+// NewMultiView return view of all keys of sets
+func NewMultiView(sets ...*SortedSet) *MultiView {
+	buckets := make([]*BucketStore, len(sets))
+	for i, set := range sets {
+		buckets[i] = Bucket(set, "")
+	}
+	return NewBucketView(buckets...)
+}
+
+// NewBucketView return view of buckets, keys are without bucket names.
+// Buckets may be in the same set
+func NewBucketView(buckets ...*BucketStore) *MultiView {
+	v := &MultiView{sources: buckets}
+	seen := map[*SortedSet]bool{}
+	for _, bkt := range buckets {
+		if !seen[bkt.Set] {
+			seen[bkt.Set] = true
+			v.sets = append(v.sets, bkt.Set)
+		}
+	}
+	// the same lock order in all views, and every set is locked once
+	sort.Slice(v.sets, func(i, j int) bool {
+		return uintptr(unsafe.Pointer(v.sets[i])) < uintptr(unsafe.Pointer(v.sets[j]))
+	})
+	return v
+}
+
+func (v *MultiView) rlock() {
+	for _, set := range v.sets {
+		set.RLock()
+	}
+}
+
+func (v *MultiView) runlock() {
+	for i := len(v.sets) - 1; i >= 0; i-- {
+		v.sets[i].RUnlock()
+	}
+}
+
+// Has return true if key is in any source
+func (v *MultiView) Has(key string) bool {
+	for _, bkt := range v.sources {
+		if bkt.Set.Has(bkt.Name + key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Range call fn for keys >= from and < to in order, until fn return false.
+// Empty to means no upper bound. Sets are locked for writes during Range,
+// fn must not modify them
+func (v *MultiView) Range(from, to string, order Order, fn func(key string) bool) {
+	v.rlock()
+	defer v.runlock()
+	v.rangeKeys(from, to, order, fn)
+}
+
+// rangeKeys merge ranges of sources, like Store merge
+func (v *MultiView) rangeKeys(from, to string, order Order, fn func(key string) bool) {
+	srcs := make([]*rangeCursor, len(v.sources))
+	for i, bkt := range v.sources {
+		end := PrefixEnd(bkt.Name)
+		if to != "" {
+			end = bkt.Name + to
+		}
+		srcs[i] = newRangeCursor(bkt.Set, nil, kindPut, bkt.Name+from, end, order)
+	}
+	for {
+		best := -1
+		bestKey := ""
+		for i, src := range srcs {
+			if !src.ok {
+				continue
+			}
+			key := src.key[len(v.sources[i].Name):]
+			if best < 0 || (order == Ascending && key < bestKey) || (order == Descending && key > bestKey) {
+				best, bestKey = i, key
+			}
+		}
+		if best < 0 {
+			return
+		}
+		for i, src := range srcs {
+			if src.ok && src.key[len(v.sources[i].Name):] == bestKey {
+				src.next()
+			}
+		}
+		if !fn(bestKey) {
+			return
+		}
+	}
+}
+
+// Count return number of distinct keys >= from and < to
+func (v *MultiView) Count(from, to string) (n int) {
+	v.Range(from, to, Descending, func(string) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Len return number of distinct keys
+func (v *MultiView) Len() int {
+	return v.Count("", "")
+}
+
+// Keys return all distinct keys in descending order
+func (v *MultiView) Keys() (result []string) {
+	result = []string{}
+	v.Range("", "", Descending, func(key string) bool {
+		result = append(result, key)
+		return true
+	})
+	return result
+}
+
+// MultiCursor iterate over MultiView in both directions.
+// First is the smallest key, Next move to greater key.
+// Cursor keep only current key, every move seek it in all sources,
+// so it's valid after changes of sets
+type MultiCursor struct {
+	v   *MultiView
+	key string
+	ok  bool
+}
+
+// Cursor return cursor, it's not positioned until First, Last or Seek
+func (v *MultiView) Cursor() *MultiCursor {
+	return &MultiCursor{v: v}
+}
+
+// move to the first key of range in order
+func (c *MultiCursor) move(from, to string, order Order) bool {
+	c.key, c.ok = "", false
+	c.v.Range(from, to, order, func(key string) bool {
+		c.key, c.ok = key, true
+		return false
+	})
+	return c.ok
+}
+
+// First move to the smallest key, false if view is empty
+func (c *MultiCursor) First() bool {
+	return c.move("", "", Ascending)
+}
+
+// Last move to the greatest key, false if view is empty
+func (c *MultiCursor) Last() bool {
+	return c.move("", "", Descending)
+}
+
+// Seek move to the first key >= key, false if there is no such key
+func (c *MultiCursor) Seek(key string) bool {
+	return c.move(key, "", Ascending)
+}
+
+// Next move to the next greater key, false at the end
+func (c *MultiCursor) Next() bool {
+	if !c.ok {
+		return false
+	}
+	return c.move(c.key+"\x00", "", Ascending)
+}
+
+// Prev move to the next smaller key, false at the end
+func (c *MultiCursor) Prev() bool {
+	if !c.ok || c.key == "" {
+		c.ok = false
+		return false
+	}
+	return c.move("", c.key, Descending)
+}
+
+// Key return key at cursor
+func (c *MultiCursor) Key() string {
+	return c.key
+}
@@ -0,0 +1,133 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiView(t *testing.T) {
+	hot, cold, empty := New(WithPageSize(8)), New(WithStorage(StorageArena)), New()
+	model := map[string]bool{}
+	for i, key := range randKeysBin(2000) {
+		switch i % 3 {
+		case 0:
+			hot.Put(key)
+		case 1:
+			cold.Put(key)
+		default:
+			hot.Put(key)
+			cold.Put(key)
+		}
+		model[key] = true
+	}
+	v := NewMultiView(hot, empty, cold)
+	desc := storeModel(model, Descending)
+	asc := storeModel(model, Ascending)
+	assert.Equal(t, desc, v.Keys())
+	assert.Equal(t, len(model), v.Len())
+	for _, key := range asc[:100] {
+		assert.True(t, v.Has(key))
+		assert.False(t, v.Has(key+"\x00"))
+	}
+
+	for i := 0; i < 50; i++ {
+		from, to := asc[rand.Intn(len(asc))], asc[rand.Intn(len(asc))]
+		if i%5 == 0 {
+			to = ""
+		}
+		var want []string
+		for _, key := range asc {
+			if key >= from && (to == "" || key < to) {
+				want = append(want, key)
+			}
+		}
+		var got []string
+		v.Range(from, to, Ascending, func(key string) bool {
+			got = append(got, key)
+			return true
+		})
+		assert.Equal(t, want, got)
+		assert.Equal(t, len(want), v.Count(from, to))
+		got = got[:0]
+		v.Range(from, to, Descending, func(key string) bool {
+			got = append(got, key)
+			return len(got) < 10
+		})
+		sort.Sort(sort.Reverse(sort.StringSlice(want)))
+		if len(want) > 10 {
+			want = want[:10]
+		}
+		assert.Equal(t, want, got)
+	}
+
+	c := v.Cursor()
+	assert.False(t, c.Next())
+	var got []string
+	for ok := c.First(); ok; ok = c.Next() {
+		got = append(got, c.Key())
+	}
+	assert.Equal(t, asc, got)
+	got = got[:0]
+	for ok := c.Last(); ok; ok = c.Prev() {
+		got = append(got, c.Key())
+	}
+	assert.Equal(t, desc, got)
+	assert.True(t, c.Seek(asc[10]+"\x00"))
+	assert.Equal(t, asc[11], c.Key())
+	assert.True(t, c.Prev())
+	assert.Equal(t, asc[10], c.Key())
+
+	// cursor see changes of sets
+	cold.Put(asc[10] + "\x00")
+	assert.True(t, c.Next())
+	assert.Equal(t, asc[10]+"\x00", c.Key())
+
+	v = NewMultiView(empty)
+	assert.Equal(t, []string{}, v.Keys())
+	assert.False(t, v.Cursor().First())
+	assert.False(t, v.Cursor().Last())
+}
+
+func TestBucketView(t *testing.T) {
+	set, archive := New(WithPageSize(4)), New()
+	for _, key := range []string{"user:rob", "user:bob", "old:alice", "old:bob", "item:1"} {
+		set.Put(key)
+	}
+	archive.Put("users/zed")
+	archive.Put("users/")
+	v := NewBucketView(Bucket(set, "user:"), Bucket(set, "old:"), Bucket(archive, "users/"))
+	assert.Equal(t, []string{"zed", "rob", "bob", "alice", ""}, v.Keys())
+	assert.True(t, v.Has("alice"))
+	assert.True(t, v.Has(""))
+	assert.False(t, v.Has("1"))
+	assert.Equal(t, 2, v.Count("b", "z"))
+	c := v.Cursor()
+	assert.True(t, c.First())
+	assert.Equal(t, "", c.Key())
+	assert.False(t, c.Prev())
+
+	// buckets of the same set are read under one lock, writers don't deadlock
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			set.Put("user:" + string(rune('a'+i%26)))
+			set.Delete("old:" + string(rune('a'+i%26)))
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		prev := "\xff"
+		v.Range("", "", Descending, func(key string) bool {
+			assert.True(t, key < prev)
+			prev = key
+			return true
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, 31, v.Len())
+}
@@ -0,0 +1,88 @@
+package sortedset
+
+import "sync/atomic"
+
+// Snapshot is a read-only point-in-time view of set. It share pages with
+// set and read them without lock, writers copy pages they change.
+// Snapshot is safe for concurrent use, Release too
+type Snapshot struct {
+	set atomic.Pointer[SortedSet]
+}
+
+// Snapshot return view of current state of set in O(1)
+func (set *SortedSet) Snapshot() *Snapshot {
+	s := &Snapshot{}
+	s.set.Store(set.Clone())
+	return s
+}
+
+// Release drop snapshot pages, they are freed by GC when set do not
+// share them anymore. Snapshot is empty after Release.
+// Unreleased snapshot is freed by GC too. Reads which run during
+// Release see snapshot before it
+func (s *Snapshot) Release() {
+	s.set.Store(New())
+}
+
+// Len return number of keys
+func (s *Snapshot) Len() int {
+	return s.set.Load().count
+}
+
+// Has return true if key in snapshot
+func (s *Snapshot) Has(key string) bool {
+	return s.set.Load().has(key)
+}
+
+// Keys return all keys in set order
+func (s *Snapshot) Keys() []string {
+	return s.set.Load().Keys()
+}
+
+// Range call fn for keys >= from and < to in order, until fn return false.
+// Empty to means no upper bound
+func (s *Snapshot) Range(from, to string, order Order, fn func(key string) bool) {
+	s.set.Load().rangeKeys(from, to, order, fn)
+}
+
+// Cursor return cursor over bucket keys, use empty name for all keys.
+// Cursor is not positioned until First, Last or Seek
+func (s *Snapshot) Cursor(bucket string) *SnapshotCursor {
+	return &SnapshotCursor{c: pageCursor{ix: s.set.Load(), prefix: bucket, idxPage: -1}}
+}
+
+// SnapshotCursor iterate over keys of snapshot in both directions.
+// First is the smallest key, Next move to greater key
+type SnapshotCursor struct {
+	c pageCursor
+}
+
+// First move to the smallest key, false if there are no keys
+func (c *SnapshotCursor) First() bool {
+	return c.c.first()
+}
+
+// Last move to the greatest key, false if there are no keys
+func (c *SnapshotCursor) Last() bool {
+	return c.c.last()
+}
+
+// Seek move to the first key >= key, false if there is no such key
+func (c *SnapshotCursor) Seek(key string) bool {
+	return c.c.seek(key)
+}
+
+// Next move to the next greater key, false at the end
+func (c *SnapshotCursor) Next() bool {
+	return c.c.next()
+}
+
+// Prev move to the next smaller key, false at the end
+func (c *SnapshotCursor) Prev() bool {
+	return c.c.prev()
+}
+
+// Key return key at cursor without bucket name
+func (c *SnapshotCursor) Key() string {
+	return c.c.key
+}
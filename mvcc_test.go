@@ -0,0 +1,111 @@
+package sortedset
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotView(t *testing.T) {
+	for _, s := range storages {
+		set := New(WithPageSize(16), WithStorage(s.storage))
+		for i := 0; i < 1000; i++ {
+			set.Put(fmt.Sprintf("user:%04d", i))
+		}
+		set.Put("item")
+		snap := set.Snapshot()
+		want := set.Keys()
+
+		// writers are not blocked by readers
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				set.Delete(fmt.Sprintf("user:%04d", i))
+				set.Put(fmt.Sprintf("user:%04dx", i))
+			}
+		}()
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var got []string
+				snap.Range("", "", Descending, func(key string) bool {
+					got = append(got, key)
+					return true
+				})
+				assert.Equal(t, want, got)
+				assert.True(t, snap.Has("user:0500"))
+			}()
+		}
+		wg.Wait()
+		assert.NoError(t, set.Validate())
+		assert.Equal(t, 1001, set.Len())
+		assert.False(t, set.Has("user:0500"))
+
+		assert.Equal(t, want, snap.Keys())
+		assert.Equal(t, 1001, snap.Len())
+		var got []string
+		snap.Range("user:0100", "user:0103", Ascending, func(key string) bool {
+			got = append(got, key)
+			return true
+		})
+		assert.Equal(t, []string{"user:0100", "user:0101", "user:0102"}, got)
+
+		c := snap.Cursor("user:")
+		assert.True(t, c.First())
+		assert.Equal(t, "0000", c.Key())
+		assert.True(t, c.Next())
+		assert.Equal(t, "0001", c.Key())
+		assert.True(t, c.Last())
+		assert.Equal(t, "0999", c.Key())
+		assert.False(t, c.Next())
+		c = snap.Cursor("")
+		assert.True(t, c.Last())
+		assert.Equal(t, "user:0999", c.Key())
+		assert.True(t, c.Seek("i"))
+		assert.Equal(t, "item", c.Key())
+
+		snap.Release()
+		assert.Equal(t, 0, snap.Len())
+		assert.False(t, snap.Has("item"))
+		assert.Empty(t, snap.Keys())
+	}
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	set := New(WithPageSize(16))
+	for i := 0; i < 1000; i++ {
+		set.Put(fmt.Sprintf("%04d", i))
+	}
+	snap := set.Snapshot()
+
+	// readers see full snapshot or empty one, never a part of it
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				n := 0
+				snap.Range("", "", Ascending, func(key string) bool {
+					n++
+					return true
+				})
+				assert.Contains(t, []int{0, 1000}, n)
+				assert.Contains(t, []int{0, 1000}, snap.Len())
+				c := snap.Cursor("")
+				if c.First() {
+					assert.Equal(t, "0000", c.Key())
+				}
+			}
+		}()
+	}
+	snap.Release()
+	wg.Wait()
+	assert.Equal(t, 0, snap.Len())
+	assert.Equal(t, 1000, set.Len())
+}
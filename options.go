@@ -0,0 +1,142 @@
+package sortedset
+
+import "fmt"
+
+const (
+	defaultCapacity = 1024
+	defaultPageSize = 256
+	maxPageSize     = 1 << 16
+	// adaptiveKeyLen is a key length for which adaptive page keep
+	// its page size, pages with shorter keys grow and with longer shrink
+	adaptiveKeyLen = 16
+)
+
+// Option configure set created by New, it's one of With* options.
+// For compatibility with New(capacity) an int is accepted as WithCapacity,
+// values <= 4 are ignored. Other types are invalid options
+type Option interface{}
+
+// option is a typed option returned by With* functions
+type option func(*options) error
+
+type options struct {
+	capacity int
+	pageSize int
+	storage  Storage
+	order    Order
+	adaptive bool
+	minPage  int
+	maxPage  int
+	name     string
+	observer Observer
+	bloom    float64
+}
+
+func defaultOptions() options {
+	return options{
+		capacity: defaultCapacity,
+		pageSize: defaultPageSize,
+		storage:  StorageArray,
+		order:    Descending,
+	}
+}
+
+func (o *options) apply(opt Option) error {
+	switch opt := opt.(type) {
+	case option:
+		return opt(o)
+	case int:
+		if opt > 4 {
+			o.capacity = int(nextPowerOf2(uint32(opt)))
+		}
+		return nil
+	}
+	return fmt.Errorf("sortedset: unsupported option %T", opt)
+}
+
+// WithCapacity preallocate index for capacity pages, rounded up to power of 2.
+// Default is 1024
+func WithCapacity(capacity int) Option {
+	return option(func(o *options) error {
+		if capacity <= 0 {
+			return fmt.Errorf("sortedset: capacity %d, must be > 0", capacity)
+		}
+		o.capacity = int(nextPowerOf2(uint32(capacity)))
+		return nil
+	})
+}
+
+// WithPageSize set number of keys in page, rounded up to power of 2.
+// Default is 256, must be in 4..65536.
+// Small pages are faster on insert, large pages use less memory on index
+func WithPageSize(pageSize int) Option {
+	return option(func(o *options) error {
+		if pageSize < 4 || pageSize > maxPageSize {
+			return fmt.Errorf("sortedset: page size %d, must be in 4..%d", pageSize, maxPageSize)
+		}
+		o.pageSize = int(nextPowerOf2(uint32(pageSize)))
+		return nil
+	})
+}
+
+// WithStorage set layout of keys in page, default is StorageArray
+func WithStorage(storage Storage) Option {
+	return option(func(o *options) error {
+		if storage < StorageArray || storage > StorageArena {
+			return fmt.Errorf("sortedset: unknown storage %d", storage)
+		}
+		o.storage = storage
+		return nil
+	})
+}
+
+// WithOrder set order of keys returned by Keys and Match,
+// default is Descending. Keys are stored in descending order anyway
+func WithOrder(order Order) Option {
+	return option(func(o *options) error {
+		if order != Descending && order != Ascending {
+			return fmt.Errorf("sortedset: unknown order %d", order)
+		}
+		o.order = order
+		return nil
+	})
+}
+
+// WithMetrics instrument set with observer, see Instrument
+func WithMetrics(name string, observer Observer) Option {
+	return option(func(o *options) error {
+		o.name = name
+		o.observer = observer
+		return nil
+	})
+}
+
+// WithBloom keep bloom filter in every page with false positive rate fp,
+// like 0.01. Has for absent key check filter instead of page keys.
+// Filter use about -1.44*log2(fp) bits per key of page size
+func WithBloom(fp float64) Option {
+	return option(func(o *options) error {
+		if !(fp > 0 && fp < 1) {
+			return fmt.Errorf("sortedset: bloom false positive rate %v, must be in (0, 1)", fp)
+		}
+		o.bloom = fp
+		return nil
+	})
+}
+
+// WithAdaptivePages let page size change between minSize and maxSize.
+// Full page with short keys grow instead of split, underused page with
+// long keys shrink, so page keep about page size * 16 bytes of keys.
+// Inserts at the edge of page, like ascending or descending sequences,
+// split page unevenly and leave full pages behind
+func WithAdaptivePages(minSize, maxSize int) Option {
+	return option(func(o *options) error {
+		if minSize < 4 || maxSize < minSize || maxSize > maxPageSize {
+			return fmt.Errorf("sortedset: adaptive pages %d..%d, must be in 4..%d", minSize, maxSize, maxPageSize)
+		}
+		o.adaptive = true
+		o.minPage = int(nextPowerOf2(uint32(minSize)))
+		o.maxPage = int(nextPowerOf2(uint32(maxSize)))
+		return nil
+	})
+}
@@ -0,0 +1,137 @@
+package sortedset
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageSize(t *testing.T) {
+	set := New(WithPageSize(4))
+	for _, key := range []string{"1", "3", "5", "7", "9", "6"} {
+		set.Put(key)
+	}
+	assert.NoError(t, set.Validate())
+	assert.Equal(t, []string{"9", "7", "6", "5", "3", "1"}, set.Keys())
+	assert.Equal(t, 3, len(set.pages))
+
+	for _, size := range []int{4, 5, 64, 1024} {
+		for _, storage := range storages {
+			set := New(WithPageSize(size), WithCapacity(16), WithStorage(storage.storage))
+			keys := randKeysBin(3000)
+			for i, key := range keys {
+				set.Put(key)
+				if i%3 == 0 {
+					set.Delete(keys[i/2])
+				}
+			}
+			assert.NoError(t, set.Validate(), "size %d %s", size, storage.name)
+			assert.Equal(t, int(nextPowerOf2(uint32(size))), set.pages[0].size)
+		}
+	}
+	assert.Equal(t, 16, cap(New(WithCapacity(9)).pages))
+}
+
+func TestNewWithError(t *testing.T) {
+	set, err := NewWithError(WithCapacity(100), WithPageSize(64), WithStorage(StorageArena), WithOrder(Ascending))
+	assert.NoError(t, err)
+	assert.Equal(t, 128, cap(set.pages))
+	assert.Equal(t, 64, set.opts.pageSize)
+	assert.NotNil(t, set.arena)
+
+	for _, opt := range []Option{
+		WithCapacity(-1),
+		WithPageSize(2),
+		WithPageSize(1 << 20),
+		WithStorage(Storage(42)),
+		WithOrder(Order(42)),
+		WithAdaptivePages(64, 16),
+		"capacity",
+	} {
+		_, err := NewWithError(opt)
+		assert.Error(t, err)
+		assert.PanicsWithError(t, err.Error(), func() { New(opt) })
+	}
+	assert.Panics(t, func() { New(WithCapacity(0)) })
+	assert.Panics(t, func() { NewMultiSet(WithPageSize(-1)) })
+
+	// old signature
+	assert.Equal(t, 2048, cap(New(2000).pages))
+	assert.Equal(t, defaultCapacity, cap(New(3).pages))
+	assert.Equal(t, defaultCapacity, cap(New(0).pages))
+	_, err = NewWithError(0)
+	assert.NoError(t, err)
+}
+
+func TestWithOrder(t *testing.T) {
+	set := New(WithOrder(Ascending), WithPageSize(4))
+	users := Bucket(set, "user")
+	for _, key := range []string{"rob", "bob", "pike", "alice", "anna"} {
+		users.Put(key)
+	}
+	set.Put("item003")
+	assert.Equal(t, []string{"item003", "useralice", "useranna", "userbob", "userpike", "userrob"}, set.Keys())
+	assert.Equal(t, []string{"alice", "anna", "bob", "pike", "rob"}, users.Keys(0, 0))
+	assert.Equal(t, []string{"bob", "pike"}, users.Keys(2, 2))
+	assert.Equal(t, []string{"alice", "anna"}, users.Match("a*", 0).Keys())
+	assert.Equal(t, []string{"anna", "bob", "rob"}, users.MatchRegexp(regexp.MustCompile("n|b"), 0).Keys())
+
+	o := &countObserver{names: map[string]bool{}, ops: map[Op]int{}}
+	set = New(WithMetrics("metrics", o))
+	set.Put("a")
+	assert.Equal(t, 1, o.ops[OpPut])
+}
+
+func TestAdaptivePages(t *testing.T) {
+	// short keys grow pages: 64 * 16 / 5 bytes
+	set := New(WithPageSize(64), WithAdaptivePages(16, 1024))
+	keys := randKeys(20000)
+	for _, key := range keys {
+		set.Put(key)
+	}
+	assert.NoError(t, set.Validate())
+	assert.Equal(t, 256, set.pages[0].size)
+
+	// long keys shrink pages on delete
+	set = New(WithPageSize(64), WithAdaptivePages(16, 1024))
+	long := strings.Repeat("x", 100)
+	for _, key := range keys[:5000] {
+		set.Put(long + key)
+	}
+	for _, key := range keys[:4800] {
+		set.Delete(long + key)
+	}
+	assert.NoError(t, set.Validate())
+	small := 0
+	for _, p := range set.pages {
+		if p.size < 64 {
+			small++
+		}
+	}
+	assert.True(t, small > 0)
+	assert.Equal(t, 200, set.Len())
+
+	// sequential inserts fill pages
+	for _, order := range []string{"asc", "desc"} {
+		set = New(WithPageSize(64), WithAdaptivePages(64, 64))
+		sort.Strings(keys)
+		if order == "desc" {
+			sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+		}
+		for _, key := range keys {
+			set.Put(key)
+		}
+		assert.NoError(t, set.Validate())
+		assert.True(t, len(set.pages) < len(keys)/60, "%s pages %d", order, len(set.pages))
+	}
+
+	set = New(WithPageSize(64))
+	for i := 0; i < 20000; i++ {
+		set.Put(fmt.Sprintf("%05d", i))
+	}
+	assert.True(t, len(set.pages) > 20000/40)
+}
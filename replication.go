@@ -0,0 +1,390 @@
+package sortedset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Replication stream, every frame is: kind byte, uvarint seq,
+// uvarint payload length, payload
+//
+//	hello     follower to primary, seq of the last applied change,
+//	          payload is id of primary it was applied from, uint64
+//	snapshot  primary to follower, set at seq, payload is primary id
+//	          uint64 and set in snapshot file format
+//	put, del  primary to follower, change with seq, payload is key
+//
+// Follower of other primary, or follower older than primary log, get
+// snapshot and then changes after it. Payload length is limited by
+// frame kind, see frameLimit
+const (
+	frameHello byte = iota + 1
+	frameSnapshot
+	framePut
+	frameDel
+
+	defaultReplicationLog = 64 << 10
+	maxFrameLen           = 1<<31 - 1
+	frameChunk            = 64 << 10 // larger frames are not allocated by header
+	replicationBatch      = 1024
+)
+
+var (
+	// ErrPrimaryClosed returned by Serve after Primary Close
+	ErrPrimaryClosed = errors.New("sortedset: primary is closed")
+	// ErrReplication returned on malformed or out of order replication frame
+	ErrReplication = errors.New("sortedset: bad replication stream")
+)
+
+// Primary replicate changes of set to followers. Every Put and Delete
+// get sequence number and is kept in log of last changes, followers
+// connected by Serve receive them in order.
+// Set must be changed only with Primary methods, other writes are not
+// replicated
+type Primary struct {
+	set    *SortedSet
+	id     uint64
+	mu     sync.Mutex
+	cond   *sync.Cond
+	seq    uint64
+	log    []replOp // change with seq s is at s % len(log)
+	closed bool
+}
+
+type replOp struct {
+	key    string
+	delete bool
+}
+
+// NewPrimary create primary for set, logSize is number of last changes
+// kept for followers catch-up, 0 for default 65536.
+// Followers which are behind more than logSize changes get snapshot
+func NewPrimary(set *SortedSet, logSize int) *Primary {
+	if logSize <= 0 {
+		logSize = defaultReplicationLog
+	}
+	p := &Primary{set: set, log: make([]replOp, logSize)}
+	for p.id == 0 {
+		p.id = rand.Uint64()
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Put add key to set and send it to followers
+func (p *Primary) Put(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// writes are serialized by p.mu, so key can't be added in between
+	if p.set.Has(key) {
+		return
+	}
+	p.set.Put(key)
+	p.append(replOp{key: key})
+}
+
+// Delete remove key from set and from followers, return true if key was present
+func (p *Primary) Delete(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.set.Delete(key) {
+		return false
+	}
+	p.append(replOp{key: key, delete: true})
+	return true
+}
+
+func (p *Primary) append(op replOp) {
+	p.seq++
+	p.log[p.seq%uint64(len(p.log))] = op
+	p.cond.Broadcast()
+}
+
+// Seq return sequence number of the last change
+func (p *Primary) Seq() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seq
+}
+
+// Close stop all Serve calls, set stay usable
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+	return nil
+}
+
+// ServeListener accept followers and serve each in own goroutine,
+// until Accept return error
+func (p *Primary) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go p.Serve(conn)
+	}
+}
+
+// Serve read hello of follower from rw and send it changes until
+// follower disconnect or primary is closed. Serve close rw on return,
+// it stop reading of rw
+func (p *Primary) Serve(rw io.ReadWriteCloser) error {
+	defer rw.Close()
+	r := bufio.NewReader(rw)
+	kind, seq, payload, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if kind != frameHello || len(payload) != 8 {
+		return ErrReplication
+	}
+	// follower send nothing after hello, read end when it disconnect
+	var gone atomic.Bool
+	go func() {
+		io.Copy(io.Discard, r)
+		p.mu.Lock()
+		gone.Store(true)
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}()
+	// next is seq of change to send, 0 when follower need snapshot
+	next := seq + 1
+	if binary.LittleEndian.Uint64(payload) != p.id {
+		next = 0
+	}
+	w := bufio.NewWriter(rw)
+	batch := make([]replOp, 0, replicationBatch)
+	for {
+		p.mu.Lock()
+		for !p.closed && !gone.Load() && next == p.seq+1 {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.mu.Unlock()
+			return ErrPrimaryClosed
+		}
+		if gone.Load() {
+			p.mu.Unlock()
+			return io.EOF
+		}
+		if next == 0 || next > p.seq+1 || p.seq+1-next > uint64(len(p.log)) {
+			snap, seq := p.set.Clone(), p.seq
+			p.mu.Unlock()
+			if err := p.writeSnapshot(w, snap, seq); err != nil {
+				return err
+			}
+			next = seq + 1
+			continue
+		}
+		first := next
+		batch = batch[:0]
+		for ; next <= p.seq && len(batch) < replicationBatch; next++ {
+			batch = append(batch, p.log[next%uint64(len(p.log))])
+		}
+		p.mu.Unlock()
+		for i, op := range batch {
+			kind := framePut
+			if op.delete {
+				kind = frameDel
+			}
+			if err := writeFrame(w, kind, first+uint64(i), []byte(op.key)); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// writeSnapshot send clone of set taken at seq
+func (p *Primary) writeSnapshot(w *bufio.Writer, snap *SortedSet, seq uint64) error {
+	var buf bytes.Buffer
+	buf.Write(binary.LittleEndian.AppendUint64(nil, p.id))
+	if err := snap.WriteSnapshot(&buf); err != nil {
+		return err
+	}
+	if err := writeFrame(w, frameSnapshot, seq, buf.Bytes()); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Follower apply changes from primary to set. Set must not be changed
+// by other writers, it's read-only copy of primary set
+type Follower struct {
+	set       *SortedSet
+	mu        sync.Mutex // serialize Follow
+	id        uint64     // primary id
+	seq       atomic.Uint64
+	snapshots int // number of loaded snapshots
+}
+
+// NewFollower create follower for set, set may be not empty, it's
+// replaced by primary snapshot on first Follow
+func NewFollower(set *SortedSet) *Follower {
+	return &Follower{set: set}
+}
+
+// Seq return sequence number of the last applied change
+func (f *Follower) Seq() uint64 {
+	return f.seq.Load()
+}
+
+// Follow send hello to primary and apply changes from rw until read
+// error, io.EOF when primary close connection. Call Follow again with
+// new connection to continue from the last applied change
+func (f *Follower) Follow(rw io.ReadWriter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := bufio.NewWriter(rw)
+	if err := writeFrame(w, frameHello, f.seq.Load(), binary.LittleEndian.AppendUint64(nil, f.id)); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	r := bufio.NewReader(rw)
+	for {
+		kind, seq, payload, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case frameSnapshot:
+			if err := f.load(payload); err != nil {
+				return err
+			}
+			f.seq.Store(seq)
+		case framePut, frameDel:
+			if f.id == 0 || seq != f.seq.Load()+1 {
+				return ErrReplication
+			}
+			if kind == frameDel {
+				f.set.Delete(string(payload))
+			} else {
+				f.set.Put(string(payload))
+			}
+			f.seq.Store(seq)
+		default:
+			return ErrReplication
+		}
+	}
+}
+
+// load replace keys of set with snapshot keys
+func (f *Follower) load(payload []byte) error {
+	if len(payload) < 8+headerSize+trailerSize {
+		return ErrCorrupt
+	}
+	m := &MappedSet{data: payload[8:]}
+	if err := m.open(0); err != nil {
+		return err
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	set := f.set
+	set.Lock()
+	defer set.Unlock()
+	var stale []string
+	for _, p := range set.pages {
+		for i := 0; i < p.numItems; i++ {
+			if key := p.key(i); !m.Has(key) {
+				stale = append(stale, key)
+			}
+		}
+	}
+	for _, key := range stale {
+		set.delete(key)
+	}
+	for i := 0; i < m.pages; i++ {
+		for j := 0; j < m.numItems(i); j++ {
+			if key := m.key(i, j); !set.has(key) {
+				// mapped key point into payload
+				set.put(strings.Clone(key))
+			}
+		}
+	}
+	f.id = binary.LittleEndian.Uint64(payload)
+	f.snapshots++
+	return nil
+}
+
+func writeFrame(w *bufio.Writer, kind byte, seq uint64, payload []byte) error {
+	b := make([]byte, 0, 1+2*binary.MaxVarintLen64)
+	b = append(b, kind)
+	b = binary.AppendUvarint(b, seq)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (kind byte, seq uint64, payload []byte, err error) {
+	if kind, err = r.ReadByte(); err != nil {
+		return
+	}
+	if seq, err = binary.ReadUvarint(r); err != nil {
+		return kind, seq, nil, unexpectedEOF(err)
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return kind, seq, nil, unexpectedEOF(err)
+	}
+	if n > frameLimit(kind) {
+		return kind, seq, nil, ErrReplication
+	}
+	payload, err = readPayload(r, n)
+	return kind, seq, payload, err
+}
+
+// readPayload read n bytes. Large payload is read as it come,
+// so length which is a lie do not allocate memory
+func readPayload(r io.Reader, n uint64) ([]byte, error) {
+	if n <= frameChunk {
+		payload := make([]byte, n)
+		_, err := io.ReadFull(r, payload)
+		return payload, unexpectedEOF(err)
+	}
+	var buf bytes.Buffer
+	m, err := buf.ReadFrom(io.LimitReader(r, int64(n)))
+	if err == nil && uint64(m) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
+// frameLimit return max payload length of frame kind
+func frameLimit(kind byte) uint64 {
+	switch kind {
+	case frameHello:
+		return 8
+	case framePut, frameDel:
+		return maxKeyLen
+	case frameSnapshot, frameSummaries, frameRangeKeys:
+		return maxFrameLen
+	}
+	return 0
+}
+
+// unexpectedEOF report EOF inside of frame as io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,270 @@
+package sortedset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// follow connect follower to primary with pipe, return func which
+// disconnect it and wait for both sides
+func follow(p *Primary, f *Follower) (stop func() error) {
+	c1, c2 := net.Pipe()
+	var wg sync.WaitGroup
+	var err error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.Serve(c1)
+	}()
+	go func() {
+		defer wg.Done()
+		err = f.Follow(c2)
+		c2.Close()
+	}()
+	return func() error {
+		c2.Close()
+		c1.Close()
+		wg.Wait()
+		return err
+	}
+}
+
+func waitSeq(t *testing.T, f *Follower, seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Seq() != seq {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower seq %d, want %d", f.Seq(), seq)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	set := New(WithPageSize(16))
+	for _, key := range randKeys(500) {
+		set.Put(key)
+	}
+	p := NewPrimary(set, 0)
+	followers := []*Follower{NewFollower(New()), NewFollower(New(WithStorage(StorageArena)))}
+	// stale key is removed by snapshot
+	followers[1].set.Put("stale")
+	var stops []func() error
+	for _, f := range followers {
+		stops = append(stops, follow(p, f))
+	}
+
+	keys := randKeys(2000)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(keys); i += 4 {
+				p.Put(keys[i])
+				if i%3 == 0 {
+					p.Delete(keys[rand.Intn(i+1)])
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, f := range followers {
+		waitSeq(t, f, p.Seq())
+		assert.Equal(t, set.Keys(), f.set.Keys())
+		assert.NoError(t, f.set.Validate())
+		assert.Equal(t, 1, f.snapshots)
+	}
+	assert.NoError(t, p.Close())
+	for _, stop := range stops {
+		assert.Error(t, stop())
+	}
+}
+
+func TestReplicationCatchUp(t *testing.T) {
+	set := New()
+	p := NewPrimary(set, 100)
+	f := NewFollower(New())
+	stop := follow(p, f)
+	p.Put("a")
+	p.Put("b")
+	waitSeq(t, f, 2)
+	stop()
+
+	// behind less than log, catch up from log
+	p.Put("c")
+	p.Delete("a")
+	assert.False(t, p.Delete("a"))
+	p.Put("b")
+	assert.Equal(t, uint64(4), p.Seq())
+	stop = follow(p, f)
+	waitSeq(t, f, 4)
+	assert.Equal(t, []string{"c", "b"}, f.set.Keys())
+	assert.Equal(t, 1, f.snapshots)
+	stop()
+
+	// behind more than log, get snapshot
+	for _, key := range randKeys(300) {
+		p.Put(key)
+	}
+	stop = follow(p, f)
+	waitSeq(t, f, p.Seq())
+	assert.Equal(t, set.Keys(), f.set.Keys())
+	assert.Equal(t, 2, f.snapshots)
+
+	// follower fall behind while connected
+	small := NewPrimary(New(), 4)
+	slow := NewFollower(New())
+	c1, c2 := net.Pipe()
+	go small.Serve(c1)
+	w := bufio.NewWriter(c2)
+	assert.NoError(t, writeFrame(w, frameHello, 0, make([]byte, 8)))
+	assert.NoError(t, w.Flush())
+	r := bufio.NewReader(c2)
+	kind, _, _, err := readFrame(r)
+	assert.NoError(t, err)
+	assert.Equal(t, frameSnapshot, kind)
+	// primary wait for write of the next batch while log overflow
+	for i := 0; i < 20; i++ {
+		small.Put(string(rune('a' + i)))
+	}
+	for {
+		kind, seq, _, err := readFrame(r)
+		if !assert.NoError(t, err) {
+			break
+		}
+		if kind == frameSnapshot {
+			assert.True(t, seq > 4)
+			break
+		}
+	}
+	c2.Close()
+	stop2 := follow(small, slow)
+	waitSeq(t, slow, 20)
+	assert.Equal(t, small.set.Keys(), slow.set.Keys())
+	stop2()
+	small.Close()
+
+	// restarted primary has other id, follower reload snapshot
+	stop()
+	p.Close()
+	p = NewPrimary(New(), 0)
+	p.Put("x")
+	stop = follow(p, f)
+	waitSeq(t, f, 1)
+	assert.Equal(t, []string{"x"}, f.set.Keys())
+	assert.Equal(t, 3, f.snapshots)
+	p.Close()
+	stop()
+}
+
+func TestReplicationTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	set := New()
+	p := NewPrimary(set, 0)
+	defer p.Close()
+	go p.ServeListener(l)
+
+	var followers []*Follower
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		f := NewFollower(New())
+		followers = append(followers, f)
+		go f.Follow(conn)
+	}
+	for _, key := range randKeysBin(5000) {
+		p.Put(key)
+	}
+	for _, f := range followers {
+		waitSeq(t, f, p.Seq())
+		assert.Equal(t, set.Keys(), f.set.Keys())
+	}
+}
+
+func TestReplicationErrors(t *testing.T) {
+	p := NewPrimary(New(), 0)
+	assert.Equal(t, ErrReplication, p.Serve(struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{bytes.NewReader([]byte{framePut, 1, 0}), io.Discard, io.NopCloser(nil)}))
+
+	f := NewFollower(New())
+	for _, stream := range [][]byte{
+		{framePut, 1, 1, 'a'},          // change before snapshot
+		{frameSnapshot, 1, 3, 1, 2, 3}, // short snapshot
+		{42, 0, 0},
+	} {
+		err := f.Follow(struct {
+			io.Reader
+			io.Writer
+		}{bytes.NewReader(stream), io.Discard})
+		assert.Error(t, err)
+		assert.NotEqual(t, io.EOF, err)
+	}
+	_, _, _, err := readFrame(bufio.NewReader(bytes.NewReader([]byte{framePut, 1, 5, 'a'})))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// length limits of frame kinds
+	for _, frame := range [][]byte{
+		binary.AppendUvarint([]byte{frameHello, 0}, 9),
+		binary.AppendUvarint([]byte{framePut, 1}, maxKeyLen+1),
+		binary.AppendUvarint([]byte{frameDel, 1}, maxKeyLen+1),
+		binary.AppendUvarint([]byte{frameSnapshot, 1}, maxFrameLen+1),
+		binary.AppendUvarint([]byte{42, 0}, 1),
+	} {
+		_, _, _, err := readFrame(bufio.NewReader(bytes.NewReader(frame)))
+		assert.Equal(t, ErrReplication, err)
+	}
+	// huge length in header is not allocated before payload come
+	for _, kind := range []byte{framePut, frameSnapshot, frameRangeKeys} {
+		frame := binary.AppendUvarint([]byte{kind, 1}, frameLimit(kind))
+		frame = append(frame, make([]byte, 100000)...)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, _, _, err := readFrame(bufio.NewReader(bytes.NewReader(frame)))
+		runtime.ReadMemStats(&after)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20))
+	}
+	frame := binary.AppendUvarint([]byte{frameSnapshot, 1}, 100000)
+	frame = append(frame, bytes.Repeat([]byte{7}, 100000)...)
+	kind, seq, payload, err := readFrame(bufio.NewReader(bytes.NewReader(frame)))
+	assert.NoError(t, err)
+	assert.Equal(t, frameSnapshot, kind)
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, bytes.Repeat([]byte{7}, 100000), payload)
+
+	// closed primary close connection of connected follower
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	done := make(chan error)
+	go func() {
+		done <- p.Serve(c1)
+	}()
+	w := bufio.NewWriter(c2)
+	assert.NoError(t, writeFrame(w, frameHello, 0, make([]byte, 8)))
+	assert.NoError(t, w.Flush())
+	r := bufio.NewReader(c2)
+	kind, _, _, err = readFrame(r)
+	assert.NoError(t, err)
+	assert.Equal(t, frameSnapshot, kind)
+	assert.NoError(t, p.Close())
+	assert.Equal(t, ErrPrimaryClosed, <-done)
+	_, err = r.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,229 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// sampleTries is a number of random slots checked before fallback to
+// walk over pages of range
+const sampleTries = 64
+
+// sampler pick uniform random positions in range of keys. Random page of
+// range and random slot up to the largest page size is picked until slot
+// hold a key of range, so every key has the same chance and it's O(1) for
+// well filled pages of similar size
+type sampler struct {
+	set       *SortedSet
+	firstPage int // page of the greatest key of range
+	firstItem int
+	lastPage  int // page of the smallest key of range
+	lastEnd   int // end of range in last page
+	slots     int // no page has more keys
+}
+
+// newSampler return sampler for keys >= from and < to, false if range is empty
+func (set *SortedSet) newSampler(from, to string) (*sampler, bool) {
+	if to != "" && from >= to {
+		return nil, false
+	}
+	hiPage, hiItem, loPage, loItem := set.span(from, to)
+	if loPage == len(set.pages) || loItem == 0 {
+		// range end at the end of previous page
+		loPage--
+		if loPage < 0 {
+			return nil, false
+		}
+		loItem = set.pages[loPage].numItems
+	}
+	if hiPage > loPage || (hiPage == loPage && hiItem >= loItem) {
+		return nil, false
+	}
+	return &sampler{set: set, firstPage: hiPage, firstItem: hiItem, lastPage: loPage, lastEnd: loItem, slots: set.maxSize - 1}, true
+}
+
+// items return range of items of page in sampled range
+func (s *sampler) items(idxPage int) (first, end int) {
+	end = s.set.pages[idxPage].numItems
+	if idxPage == s.firstPage {
+		first = s.firstItem
+	}
+	if idxPage == s.lastPage {
+		end = s.lastEnd
+	}
+	return first, end
+}
+
+// count return number of keys in range, it walk pages of range
+func (s *sampler) count() (n int) {
+	for i := s.firstPage; i <= s.lastPage; i++ {
+		first, end := s.items(i)
+		n += end - first
+	}
+	return n
+}
+
+// pick return random key of range
+func (s *sampler) pick() string {
+	pages := s.lastPage - s.firstPage + 1
+	for try := 0; try < sampleTries; try++ {
+		idxPage := s.firstPage + rand.Intn(pages)
+		idxItem := rand.Intn(s.slots)
+		if first, end := s.items(idxPage); idxItem >= first && idxItem < end {
+			return s.set.pages[idxPage].key(idxItem)
+		}
+	}
+	// sparse range, pick by rank
+	r := rand.Intn(s.count())
+	for i := s.firstPage; ; i++ {
+		first, end := s.items(i)
+		if r < end-first {
+			return s.set.pages[i].key(first + r)
+		}
+		r -= end - first
+	}
+}
+
+// all return all keys of range
+func (s *sampler) all() []string {
+	var keys []string
+	for i := s.firstPage; i <= s.lastPage; i++ {
+		first, end := s.items(i)
+		for j := first; j < end; j++ {
+			keys = append(keys, s.set.pages[i].key(j))
+		}
+	}
+	return keys
+}
+
+// sample return n random keys, distinct if not replace
+func (s *sampler) sample(n int, replace bool) []string {
+	if replace {
+		keys := make([]string, n)
+		for i := range keys {
+			keys[i] = s.pick()
+		}
+		return keys
+	}
+	if count := s.count(); n*2 > count {
+		// most of keys, shuffle them instead of retries on duplicates
+		keys := s.all()
+		rand.Shuffle(len(keys), func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+		if n > len(keys) {
+			n = len(keys)
+		}
+		return keys[:n]
+	}
+	keys := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for len(keys) < n {
+		if key := s.pick(); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RandomKey return uniform random key, false if set is empty
+func (set *SortedSet) RandomKey() (string, bool) {
+	return set.randomKey("", "")
+}
+
+func (set *SortedSet) randomKey(from, to string) (string, bool) {
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	s, ok := set.newSampler(from, to)
+	if !ok {
+		return "", false
+	}
+	return s.pick(), true
+}
+
+// Sample return n uniform random keys in random order. With replace keys
+// may repeat and n keys are returned for not empty set, without replace
+// keys are distinct and there are at most Len keys, like SRANDMEMBER
+// with negative and positive count in Redis
+func (set *SortedSet) Sample(n int, replace bool) []string {
+	return set.sample("", "", n, replace)
+}
+
+func (set *SortedSet) sample(from, to string, n int, replace bool) []string {
+	if n <= 0 {
+		return nil
+	}
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	s, ok := set.newSampler(from, to)
+	if !ok {
+		return nil
+	}
+	return s.sample(n, replace)
+}
+
+// RandomKey return uniform random key from bucket, false if bucket is empty
+func (bkt *BucketStore) RandomKey() (string, bool) {
+	key, ok := bkt.Set.randomKey(bkt.Name, PrefixEnd(bkt.Name))
+	if !ok {
+		return "", false
+	}
+	return key[len(bkt.Name):], true
+}
+
+// Sample return n random keys from bucket, see SortedSet.Sample
+func (bkt *BucketStore) Sample(n int, replace bool) []string {
+	keys := bkt.Set.sample(bkt.Name, PrefixEnd(bkt.Name), n, replace)
+	for i, key := range keys {
+		keys[i] = key[len(bkt.Name):]
+	}
+	return keys
+}
+
+// SampleWeighted return n random keys with replacement, bucket of every key
+// is picked with probability proportional to its weight and key is uniform
+// in bucket. Keys are returned with bucket names. Empty buckets and buckets
+// with weight <= 0 are skipped
+func (set *SortedSet) SampleWeighted(weights map[string]float64, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	// the same cumulative weights for the same seed
+	sort.Strings(names)
+
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	var samplers []*sampler
+	var cumulative []float64
+	total := 0.0
+	for _, name := range names {
+		if weights[name] <= 0 {
+			continue
+		}
+		s, ok := set.newSampler(name, PrefixEnd(name))
+		if !ok {
+			continue
+		}
+		total += weights[name]
+		samplers = append(samplers, s)
+		cumulative = append(cumulative, total)
+	}
+	if len(samplers) == 0 {
+		return nil
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		r := rand.Float64() * total
+		j := sort.SearchFloat64s(cumulative, r)
+		if j == len(samplers) {
+			j--
+		}
+		keys[i] = samplers[j].pick()
+	}
+	return keys
+}
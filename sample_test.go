@@ -0,0 +1,163 @@
+package sortedset
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertUniform check that every key is picked about the same number of times
+func assertUniform(t *testing.T, keys []string, picks []string) {
+	t.Helper()
+	counts := map[string]int{}
+	for _, key := range picks {
+		counts[key]++
+	}
+	assert.Equal(t, len(keys), len(counts))
+	want := float64(len(picks)) / float64(len(keys))
+	for _, key := range keys {
+		assert.True(t, math.Abs(float64(counts[key])-want) < want*0.5, "%q picked %d times, want %.0f", key, counts[key], want)
+	}
+}
+
+func TestRandomKey(t *testing.T) {
+	_, ok := New().RandomKey()
+	assert.False(t, ok)
+	assert.Nil(t, New().Sample(3, true))
+
+	set := New(WithPageSize(8))
+	var keys []string
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("%03d", i)
+		set.Put(key)
+		keys = append(keys, key)
+	}
+	// sparse pages after deletes
+	for i := 0; i < 100; i += 3 {
+		set.Delete(keys[i])
+	}
+	keys = set.Keys()
+	var picks []string
+	for i := 0; i < 20000; i++ {
+		key, ok := set.RandomKey()
+		assert.True(t, ok)
+		picks = append(picks, key)
+	}
+	assertUniform(t, keys, picks)
+	assertUniform(t, keys, set.Sample(20000, true))
+
+	// single key pages and fallback walk
+	sparse := New(WithPageSize(1024))
+	sparse.Put("a")
+	sparse.Put("b")
+	assertUniform(t, []string{"a", "b"}, sparse.Sample(2000, true))
+}
+
+func TestSample(t *testing.T) {
+	set := New(WithPageSize(16), WithAdaptivePages(4, 64))
+	for i := 0; i < 1000; i++ {
+		set.Put(fmt.Sprintf("key%04d", i))
+	}
+	for _, n := range []int{1, 10, 400, 600, 1000, 2000} {
+		keys := set.Sample(n, false)
+		want := n
+		if want > 1000 {
+			want = 1000
+		}
+		assert.Equal(t, want, len(keys))
+		seen := map[string]bool{}
+		for _, key := range keys {
+			assert.False(t, seen[key])
+			assert.True(t, set.Has(key))
+			seen[key] = true
+		}
+	}
+	assert.Equal(t, 2000, len(set.Sample(2000, true)))
+	assert.Nil(t, set.Sample(0, false))
+
+	// distinct samples are uniform too
+	var picks []string
+	for i := 0; i < 20000; i++ {
+		picks = append(picks, set.Sample(5, false)...)
+	}
+	assertUniform(t, set.Keys(), picks)
+}
+
+func TestSampleAdaptive(t *testing.T) {
+	// pages of short keys grow, pages of long keys shrink
+	set := New(WithPageSize(64), WithAdaptivePages(16, 4096))
+	keys := randKeys(1000)
+	long := strings.Repeat("x", 100)
+	for _, key := range keys {
+		set.Put(key)
+		set.Put(long + key)
+	}
+	for _, key := range keys[:900] {
+		set.Delete(long + key)
+	}
+	assert.NoError(t, set.Validate())
+	s, ok := set.newSampler("", "")
+	assert.True(t, ok)
+	assert.Less(t, s.slots, 4095)
+	sizes := map[int]bool{}
+	for _, p := range set.pages {
+		assert.LessOrEqual(t, p.size-1, s.slots)
+		sizes[p.size] = true
+	}
+	assert.Greater(t, len(sizes), 1)
+	assertUniform(t, set.Keys(), set.Sample(200000, true))
+	assert.Equal(t, set.maxSize, set.Clone().maxSize)
+}
+
+func TestSampleBucket(t *testing.T) {
+	set := New(WithPageSize(4))
+	for i := 0; i < 50; i++ {
+		set.Put(fmt.Sprintf("a:%02d", i))
+		set.Put(fmt.Sprintf("c:%02d", i))
+	}
+	set.Put("b:1")
+	set.Put("b:2")
+	bkt := Bucket(set, "b:")
+	assertUniform(t, []string{"1", "2"}, bkt.Sample(4000, true))
+	key, ok := bkt.RandomKey()
+	assert.True(t, ok)
+	assert.Contains(t, []string{"1", "2"}, key)
+	keys := bkt.Sample(5, false)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"1", "2"}, keys)
+	_, ok = Bucket(set, "d:").RandomKey()
+	assert.False(t, ok)
+	assert.Nil(t, Bucket(set, "ab").Sample(3, true))
+	assert.Equal(t, 102, len(Bucket(set, "").Sample(1000, false)))
+
+	picks := set.SampleWeighted(map[string]float64{"a:": 3, "b:": 1, "d:": 5, "c:": 0}, 8000)
+	counts := map[string]int{}
+	for _, key := range picks {
+		counts[key[:2]]++
+	}
+	assert.Equal(t, 2, len(counts))
+	assert.InDelta(t, 6000, counts["a:"], 300)
+	assert.InDelta(t, 2000, counts["b:"], 300)
+	for _, key := range picks {
+		if strings.HasPrefix(key, "b:") {
+			assert.Contains(t, []string{"b:1", "b:2"}, key)
+		}
+	}
+	assert.Nil(t, set.SampleWeighted(map[string]float64{"d:": 1}, 10))
+	assert.Nil(t, set.SampleWeighted(nil, 10))
+}
+
+func BenchmarkRandomKey(b *testing.B) {
+	set := New()
+	for _, key := range randKeys(1000000) {
+		set.Put(key)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set.RandomKey()
+	}
+}
@@ -0,0 +1,253 @@
+package sortedset
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Order of keys in scans
+type Order int
+
+const (
+	// Descending is native order of keys in set
+	Descending Order = iota
+	// Ascending order
+	Ascending
+)
+
+// ErrBadToken returned on malformed continuation token
+var ErrBadToken = errors.New("sortedset: bad continuation token")
+
+const tokenVersion = 1
+
+// search return position of the first key (in descending order) for which f
+// is true. f must be false for greater keys and true for smaller.
+// idxPage is len(set.pages) if there is no such key
+func (set *SortedSet) search(f func(key string) bool) (idxPage, idxItem int) {
+	idxPage = sort.Search(len(set.pages), func(n int) bool {
+		return set.pages[n].numItems > 0 && f(set.pages[n].min)
+	})
+	if idxPage == len(set.pages) {
+		return idxPage, 0
+	}
+	p := set.pages[idxPage]
+	idxItem = sort.Search(p.numItems, func(n int) bool {
+		return f(p.key(n))
+	})
+	return idxPage, idxItem
+}
+
+// at return key at position, false if position is out of set
+func (set *SortedSet) at(idxPage, idxItem int) (string, bool) {
+	if idxPage < 0 || idxPage >= len(set.pages) || idxItem < 0 || idxItem >= set.pages[idxPage].numItems {
+		return "", false
+	}
+	return set.pages[idxPage].key(idxItem), true
+}
+
+// step move position to the next smaller key, or to the next greater key
+// in ascending order
+func (set *SortedSet) step(idxPage, idxItem int, order Order) (int, int) {
+	if order == Ascending {
+		if idxItem > 0 {
+			return idxPage, idxItem - 1
+		}
+		if idxPage > 0 && idxPage <= len(set.pages) {
+			return idxPage - 1, set.pages[idxPage-1].numItems - 1
+		}
+		return -1, 0
+	}
+	if idxItem+1 < set.pages[idxPage].numItems {
+		return idxPage, idxItem + 1
+	}
+	return idxPage + 1, 0
+}
+
+// pageIndex is a set of keys in descending pages, SortedSet or MappedSet
+type pageIndex interface {
+	search(f func(key string) bool) (idxPage, idxItem int)
+	step(idxPage, idxItem int, order Order) (int, int)
+	at(idxPage, idxItem int) (string, bool)
+}
+
+// rangeStart return position of the first key of range [from, to) in order
+func rangeStart(ix pageIndex, from, to string, order Order) (idxPage, idxItem int) {
+	switch {
+	case order == Ascending:
+		idxPage, idxItem = ix.search(func(key string) bool {
+			return key < from
+		})
+		return ix.step(idxPage, idxItem, Ascending)
+	case to != "":
+		return ix.search(func(key string) bool {
+			return key < to
+		})
+	}
+	return 0, 0
+}
+
+// PrefixEnd return the smallest string greater than all strings with prefix,
+// empty if there is no such string. Range(prefix, PrefixEnd(prefix), ...)
+// walk keys with prefix
+func PrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) == 0 {
+		return ""
+	}
+	end[len(end)-1]++
+	return string(end)
+}
+
+// pageCursor walk keys with prefix in both directions,
+// first is the smallest key. Key is returned without prefix
+type pageCursor struct {
+	ix       pageIndex
+	prefix   string
+	copyKeys bool // keys of MappedSet point into file
+	idxPage  int
+	idxItem  int
+	key      string
+	ok       bool
+}
+
+func (c *pageCursor) move(idxPage, idxItem int) bool {
+	c.idxPage, c.idxItem = idxPage, idxItem
+	key, ok := c.ix.at(idxPage, idxItem)
+	c.ok = ok && strings.HasPrefix(key, c.prefix)
+	c.key = ""
+	if c.ok {
+		c.key = key[len(c.prefix):]
+		if c.copyKeys {
+			c.key = strings.Clone(c.key)
+		}
+	}
+	return c.ok
+}
+
+func (c *pageCursor) first() bool {
+	return c.move(rangeStart(c.ix, c.prefix, "", Ascending))
+}
+
+func (c *pageCursor) last() bool {
+	return c.move(rangeStart(c.ix, "", PrefixEnd(c.prefix), Descending))
+}
+
+func (c *pageCursor) seek(key string) bool {
+	return c.move(rangeStart(c.ix, c.prefix+key, "", Ascending))
+}
+
+func (c *pageCursor) next() bool {
+	if !c.ok {
+		return false
+	}
+	return c.move(c.ix.step(c.idxPage, c.idxItem, Ascending))
+}
+
+func (c *pageCursor) prev() bool {
+	if !c.ok {
+		return false
+	}
+	return c.move(c.ix.step(c.idxPage, c.idxItem, Descending))
+}
+
+// Range call fn for keys >= from and < to in order, until fn return false.
+// Empty to means no upper bound. Set is locked for writes during Range,
+// fn must not modify set
+func (set *SortedSet) Range(from, to string, order Order, fn func(key string) bool) {
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	set.rangeKeys(from, to, order, fn)
+}
+
+func (set *SortedSet) rangeKeys(from, to string, order Order, fn func(key string) bool) {
+	for idxPage, idxItem := rangeStart(set, from, to, order); ; idxPage, idxItem = set.step(idxPage, idxItem, order) {
+		key, ok := set.at(idxPage, idxItem)
+		if !ok || key < from || (to != "" && key >= to) || !fn(key) {
+			return
+		}
+	}
+}
+
+// seekPrefix return position of the first key with prefix in given order,
+// if hasAfter - position of the first key after after, it may be empty key
+func (set *SortedSet) seekPrefix(prefix, after string, hasAfter bool, order Order) (idxPage, idxItem int) {
+	switch {
+	case order == Ascending && !hasAfter:
+		// first key smaller than any key with prefix, step back
+		idxPage, idxItem = set.search(func(key string) bool {
+			return key < prefix
+		})
+		return set.step(idxPage, idxItem, Ascending)
+	case order == Ascending:
+		idxPage, idxItem = set.search(func(key string) bool {
+			return key <= after
+		})
+		return set.step(idxPage, idxItem, Ascending)
+	case !hasAfter:
+		return set.search(func(key string) bool {
+			if len(key) > len(prefix) {
+				return key[:len(prefix)] <= prefix
+			}
+			return key <= prefix
+		})
+	}
+	return set.search(func(key string) bool {
+		return key < after
+	})
+}
+
+// Scan return up to limit keys from bucket in order, starting after position
+// encoded in token. Empty token start scan from the beginning of bucket.
+// next is the token for the following page, it's empty when there are no more keys.
+// Keys inserted or deleted between calls do not shift pages.
+// if limit <= 0 - no limit
+func (bkt *BucketStore) Scan(order Order, token string, limit int) (keys []string, next string, err error) {
+	after := ""
+	if token != "" {
+		var tokenOrder Order
+		tokenOrder, after, err = decodeToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+		if tokenOrder != order {
+			return nil, "", ErrBadToken
+		}
+		after = bkt.Name + after
+	}
+
+	bkt.Set.RLock()
+	defer bkt.Set.RUnlock()
+	set := bkt.Set
+	idxPage, idxItem := set.seekPrefix(bkt.Name, after, token != "", order)
+	for {
+		key, ok := set.at(idxPage, idxItem)
+		if !ok || !strings.HasPrefix(key, bkt.Name) {
+			return keys, "", nil
+		}
+		if limit > 0 && len(keys) == limit {
+			return keys, encodeToken(order, keys[len(keys)-1]), nil
+		}
+		keys = append(keys, key[len(bkt.Name):])
+		idxPage, idxItem = set.step(idxPage, idxItem, order)
+	}
+}
+
+func encodeToken(order Order, key string) string {
+	b := make([]byte, 0, len(key)+2)
+	b = append(b, tokenVersion, byte(order))
+	b = append(b, key...)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeToken(token string) (order Order, key string, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) < 2 || b[0] != tokenVersion || b[1] > byte(Ascending) {
+		return Descending, "", ErrBadToken
+	}
+	return Order(b[1]), string(b[2:]), nil
+}
@@ -0,0 +1,151 @@
+package sortedset
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scanAll(t *testing.T, bkt *BucketStore, order Order, limit int) (all []string, pages int) {
+	token := ""
+	for {
+		keys, next, err := bkt.Scan(order, token, limit)
+		assert.NoError(t, err)
+		all = append(all, keys...)
+		pages++
+		if next == "" {
+			return all, pages
+		}
+		token = next
+	}
+}
+
+func TestScan(t *testing.T) {
+	set := New()
+	users := Bucket(set, "user")
+	items := Bucket(set, "item")
+	keys := randKeys(1000)
+	for _, key := range keys {
+		users.Put(key)
+		items.Put(key)
+	}
+	set.Put("us")
+	set.Put("user") // empty key in bucket
+	sort.Strings(keys)
+	asc := append([]string{""}, keys...)
+
+	all, pages := scanAll(t, users, Ascending, 100)
+	assert.Equal(t, asc, all)
+	assert.Equal(t, 11, pages)
+
+	desc := make([]string, len(asc))
+	for i := range asc {
+		desc[i] = asc[len(asc)-1-i]
+	}
+	all, pages = scanAll(t, users, Descending, 7)
+	assert.Equal(t, desc, all)
+	assert.Equal(t, 143, pages)
+
+	all, pages = scanAll(t, users, Descending, 0)
+	assert.Equal(t, desc, all)
+	assert.Equal(t, 1, pages)
+
+	empty := Bucket(set, "none")
+	all, _ = scanAll(t, empty, Ascending, 10)
+	assert.Empty(t, all)
+	all, _ = scanAll(t, empty, Descending, 10)
+	assert.Empty(t, all)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	assert.Equal(t, "b", PrefixEnd("a"))
+	assert.Equal(t, "user;", PrefixEnd("user:"))
+	assert.Equal(t, "b", PrefixEnd("a\xff\xff"))
+	assert.Equal(t, "", PrefixEnd("\xff"))
+	assert.Equal(t, "", PrefixEnd(""))
+}
+
+func TestScanEmptyKey(t *testing.T) {
+	set := New()
+	for _, key := range []string{"", "a", "b"} {
+		set.Put(key)
+	}
+	root := Bucket(set, "")
+	all, pages := scanAll(t, root, Ascending, 1)
+	assert.Equal(t, []string{"", "a", "b"}, all)
+	assert.Equal(t, 3, pages)
+	all, pages = scanAll(t, root, Descending, 1)
+	assert.Equal(t, []string{"b", "a", ""}, all)
+	assert.Equal(t, 3, pages)
+
+	// token after the empty key
+	keys, token, err := root.Scan(Ascending, "", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, keys)
+	keys, _, err = root.Scan(Ascending, token, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, keys)
+}
+
+func TestScanConcurrentChanges(t *testing.T) {
+	set := New()
+	bkt := Bucket(set, "b")
+	for i := 0; i < 600; i += 2 {
+		bkt.Put(fmt.Sprintf("%03d", i))
+	}
+	keys, token, err := bkt.Scan(Ascending, "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "018", keys[9])
+
+	// changes before and after position do not shift the page
+	set.Delete("b000")
+	set.Delete("b018")
+	bkt.Put("001")
+	bkt.Put("019")
+	keys, _, err = bkt.Scan(Ascending, token, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"019", "020", "022"}, keys)
+
+	keys, token, err = bkt.Scan(Descending, "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"598", "596"}, keys)
+	set.Delete("b596")
+	keys, _, err = bkt.Scan(Descending, token, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"594", "592"}, keys)
+
+	_, _, err = bkt.Scan(Ascending, token, 2)
+	assert.Equal(t, ErrBadToken, err)
+	_, _, err = bkt.Scan(Ascending, "!!", 2)
+	assert.Equal(t, ErrBadToken, err)
+}
+
+func TestRange(t *testing.T) {
+	set := New(WithPageSize(4))
+	for i := 0; i < 100; i++ {
+		set.Put(fmt.Sprintf("%03d", i))
+	}
+	collect := func(from, to string, order Order, limit int) (keys []string) {
+		set.Range(from, to, order, func(key string) bool {
+			keys = append(keys, key)
+			return len(keys) != limit
+		})
+		return keys
+	}
+	assert.Equal(t, []string{"010", "011", "012"}, collect("010", "013", Ascending, 0))
+	assert.Equal(t, []string{"012", "011", "010"}, collect("010", "013", Descending, 0))
+	assert.Equal(t, []string{"098", "099"}, collect("098", "", Ascending, 0))
+	assert.Equal(t, []string{"099", "098"}, collect("", "", Descending, 2))
+	assert.Equal(t, []string{"000", "001"}, collect("", "002", Ascending, 0))
+	assert.Empty(t, collect("0100", "0101", Ascending, 0))
+	assert.Empty(t, collect("b", "a", Descending, 0))
+	assert.Empty(t, collect("b", "a", Ascending, 0))
+	assert.Equal(t, []string{"050"}, collect("050", "050\x00", Descending, 0))
+	assert.Empty(t, New().Keys())
+	New().Range("", "", Ascending, func(key string) bool {
+		t.Fatal("key in empty set")
+		return false
+	})
+}
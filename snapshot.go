@@ -0,0 +1,174 @@
+package sortedset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot file layout, all numbers are little endian:
+//
+//	header   magic "SSETSNP1", flags uint32, reserved uint32
+//	pages    for every page: count uint32, offsets [count+1]uint32
+//	         relative to page start, keys in descending order.
+//	         With flagKinds every key is prefixed with kind byte
+//	index    for every page: offset uint64, count uint32, reserved uint32
+//	trailer  index offset uint64, pages uint32, flags uint32,
+//	         keys uint64, magic "SSETEND1"
+//
+// Like in SortedSet, first key of page is page max and last key is page min,
+// so lookup is binary search on index and then on page.
+const (
+	snapshotMagic    = "SSETSNP1"
+	snapshotEndMagic = "SSETEND1"
+	headerSize       = 16
+	indexEntrySize   = 16
+	trailerSize      = 32
+
+	// flagKinds mark file with put and delete entries, it's a store run
+	flagKinds = 1
+	kindPut   = 0
+	kindDel   = 1
+)
+
+// ErrCorrupt returned on malformed snapshot file
+var ErrCorrupt = errors.New("sortedset: corrupt snapshot")
+
+// snapshotWriter write keys in descending order into snapshot
+type snapshotWriter struct {
+	w        *bufio.Writer
+	flags    uint32
+	pageSize int
+	off      uint64
+	keys     uint64
+	page     []string
+	kinds    []byte
+	index    []byte
+	buf      []byte
+}
+
+func newSnapshotWriter(w io.Writer, flags uint32, pageSize int) (*snapshotWriter, error) {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), flags: flags, pageSize: pageSize}
+	header := make([]byte, headerSize)
+	copy(header, snapshotMagic)
+	binary.LittleEndian.PutUint32(header[8:], flags)
+	return sw, sw.write(header)
+}
+
+func (sw *snapshotWriter) write(b []byte) error {
+	n, err := sw.w.Write(b)
+	sw.off += uint64(n)
+	return err
+}
+
+// add key, keys must be added in descending order.
+// kind is stored only in files with flagKinds
+func (sw *snapshotWriter) add(key string, kind byte) error {
+	sw.page = append(sw.page, key)
+	sw.kinds = append(sw.kinds, kind)
+	sw.keys++
+	if len(sw.page) == sw.pageSize {
+		return sw.flush()
+	}
+	return nil
+}
+
+func (sw *snapshotWriter) flush() error {
+	if len(sw.page) == 0 {
+		return nil
+	}
+	sw.index = binary.LittleEndian.AppendUint64(sw.index, sw.off)
+	sw.index = binary.LittleEndian.AppendUint32(sw.index, uint32(len(sw.page)))
+	sw.index = binary.LittleEndian.AppendUint32(sw.index, 0)
+
+	b := sw.buf[:0]
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(sw.page)))
+	kinds := sw.flags&flagKinds != 0
+	pos := 4 + 4*(len(sw.page)+1)
+	for _, key := range sw.page {
+		b = binary.LittleEndian.AppendUint32(b, uint32(pos))
+		pos += len(key)
+		if kinds {
+			pos++
+		}
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(pos))
+	for i, key := range sw.page {
+		if kinds {
+			b = append(b, sw.kinds[i])
+		}
+		b = append(b, key...)
+	}
+	sw.buf = b
+	sw.page = sw.page[:0]
+	sw.kinds = sw.kinds[:0]
+	return sw.write(b)
+}
+
+// close write index and trailer
+func (sw *snapshotWriter) close() error {
+	if err := sw.flush(); err != nil {
+		return err
+	}
+	indexOffset := sw.off
+	if err := sw.write(sw.index); err != nil {
+		return err
+	}
+	trailer := make([]byte, 0, trailerSize)
+	trailer = binary.LittleEndian.AppendUint64(trailer, indexOffset)
+	trailer = binary.LittleEndian.AppendUint32(trailer, uint32(len(sw.index)/indexEntrySize))
+	trailer = binary.LittleEndian.AppendUint32(trailer, sw.flags)
+	trailer = binary.LittleEndian.AppendUint64(trailer, sw.keys)
+	trailer = append(trailer, snapshotEndMagic...)
+	if err := sw.write(trailer); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// WriteSnapshot write all keys to w in snapshot format, see OpenSnapshot
+func (set *SortedSet) WriteSnapshot(w io.Writer) error {
+	set.RLock()
+	defer set.RUnlock()
+	sw, err := newSnapshotWriter(w, 0, set.opts.pageSize)
+	if err != nil {
+		return err
+	}
+	for _, p := range set.pages {
+		for i := 0; i < p.numItems; i++ {
+			if err := sw.add(p.key(i), kindPut); err != nil {
+				return err
+			}
+		}
+	}
+	return sw.close()
+}
+
+// SaveSnapshot write snapshot to file, file is replaced atomically
+func (set *SortedSet) SaveSnapshot(path string) error {
+	return writeFileAtomic(path, set.WriteSnapshot)
+}
+
+// writeFileAtomic write temporary file and rename it to path
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err = write(f); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package sortedset
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "set.snap")
+	for _, storage := range storages {
+		set := New(WithPageSize(64), WithStorage(storage.storage))
+		keys := randKeys(5000)
+		for _, key := range keys {
+			set.Put(key)
+		}
+		set.Put("")
+		assert.NoError(t, set.SaveSnapshot(path))
+
+		m, err := OpenSnapshot(path)
+		assert.NoError(t, err)
+		assert.NoError(t, m.Validate())
+		assert.Equal(t, set.Len(), m.Len())
+		assert.Equal(t, set.Keys(), m.Keys())
+		st := m.Stats()
+		assert.Equal(t, set.Stats().Bytes, st.Bytes)
+		assert.Equal(t, (set.Len()+63)/64, st.Pages)
+		assert.Equal(t, 64, st.MaxItems)
+		for _, key := range keys {
+			assert.True(t, m.Has(key))
+			assert.False(t, m.Has(key+"0"))
+		}
+		assert.True(t, m.Has(""))
+		assert.False(t, m.Has("zzz"))
+
+		asc := append([]string{""}, keys...)
+		sort.Strings(asc)
+		var all []string
+		c := m.Cursor()
+		for ok := c.First(); ok; ok = c.Next() {
+			all = append(all, c.Key())
+		}
+		assert.Equal(t, asc, all, storage.name)
+		all = all[:0]
+		for ok := c.Last(); ok; ok = c.Prev() {
+			all = append([]string{c.Key()}, all...)
+		}
+		assert.Equal(t, asc, all)
+
+		i := sort.SearchStrings(asc, keys[0]+"0")
+		assert.True(t, c.Seek(keys[0]+"0"))
+		assert.Equal(t, asc[i], c.Key())
+		assert.True(t, c.Seek(""))
+		assert.Equal(t, "", c.Key())
+		assert.False(t, c.Seek("zzz"))
+		assert.False(t, c.Next())
+
+		from, to := asc[1000], asc[1100]
+		var got []string
+		m.Range(from, to, Ascending, func(key string) bool {
+			got = append(got, key)
+			return true
+		})
+		assert.Equal(t, asc[1000:1100], got)
+		got = got[:0]
+		m.Range(from, to, Descending, func(key string) bool {
+			got = append(got, key)
+			return len(got) < 10
+		})
+		assert.Equal(t, []string{asc[1099], asc[1098]}, got[:2])
+		assert.Equal(t, 10, len(got))
+		got = got[:0]
+		m.Range(asc[4990], "", Descending, func(key string) bool {
+			got = append(got, key)
+			return true
+		})
+		assert.Equal(t, 11, len(got))
+		assert.NoError(t, m.Close())
+	}
+}
+
+func TestSnapshotEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.snap")
+	assert.NoError(t, New().SaveSnapshot(path))
+	m, err := OpenSnapshot(path)
+	assert.NoError(t, err)
+	defer m.Close()
+	assert.Equal(t, 0, m.Len())
+	assert.Equal(t, Stats{}, m.Stats())
+	assert.False(t, m.Has(""))
+	assert.Empty(t, m.Keys())
+	assert.False(t, m.Cursor().First())
+	assert.False(t, m.Cursor().Last())
+	assert.False(t, m.Cursor().Seek(""))
+	m.Range("", "", Ascending, func(key string) bool {
+		t.Fatal("key in empty snapshot")
+		return false
+	})
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "set.snap")
+	set := New(WithPageSize(4))
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		set.Put(key)
+	}
+	assert.NoError(t, set.SaveSnapshot(path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	corrupt := func(name string, b []byte) error {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(p, b, 0o644))
+		m, err := OpenSnapshot(p)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		return m.Validate()
+	}
+	assert.Equal(t, ErrCorrupt, corrupt("short", data[:20]))
+	assert.Equal(t, ErrCorrupt, corrupt("truncated", data[:len(data)-1]))
+	b := append([]byte{}, data...)
+	b[0] = 'X'
+	assert.Equal(t, ErrCorrupt, corrupt("magic", b))
+	b = append([]byte{}, data...)
+	b[len(b)-trailerSize+8]++ // pages
+	assert.Equal(t, ErrCorrupt, corrupt("pages", b))
+
+	// swap first two keys: "e" "d" -> "d" "e"
+	b = append([]byte{}, data...)
+	i := headerSize + 4 + 4*4
+	b[i], b[i+1] = b[i+1], b[i]
+	assert.Error(t, corrupt("order", b))
+	// key offsets out of page are found by open, keys are not read out of file
+	for _, off := range []uint32{0, 3, 1 << 30} {
+		b = append([]byte{}, data...)
+		binary.LittleEndian.PutUint32(b[headerSize+4+4:], off)
+		assert.Equal(t, ErrCorrupt, corrupt("offset", b))
+	}
+	assert.NoError(t, corrupt("ok", data))
+}
@@ -2,25 +2,42 @@
 package sortedset
 
 import (
+	"errors"
 	"fmt"
+	"hash/maphash"
 	"sort"
 	"strings"
 	"sync"
 )
 
-const pageSize = 256
-
 type page struct {
-	items    [pageSize]string
+	keys     keyStore
 	min      string
 	max      string
 	numItems int
+	size     int    // page is split when it hold size-1 keys
+	bytes    int    // length of all keys
+	sum      uint64 // sum of key hashes, see Summary
+	counts   []int  // counts of keys in MultiSet, nil in SortedSet
+	filter   *bloom
+	gen      uint64 // page may be changed only by set of the same generation
 }
 
 // sortedset provide sorted set, with strings comparator
 type SortedSet struct {
 	sync.RWMutex
-	pages []*page
+	pages    []*page
+	count    int
+	opts     options
+	arena    *arena
+	name     string
+	observer Observer
+	seed     maphash.Seed
+	gen      uint64
+	shared   bool       // pages slice is shared with clone
+	counted  bool       // pages keep counts, see MultiSet
+	maxSize  int        // size of the largest page ever, see sampler
+	txMu     sync.Mutex // serialize Update transactions
 }
 
 // BucketStore store for buckets
@@ -36,27 +53,63 @@ type Cursor struct {
 	bucket *BucketStore
 }
 
-// New create sorted set with capacity (first param),
-// default is 1024, must be > 3 and power of 2
-func New(intParams ...int) *SortedSet {
-	capacity := 1024
-	if len(intParams) > 0 && intParams[0] > 4 {
-		capacity = int(nextPowerOf2(uint32(intParams[0])))
+// New create sorted set, see With* options.
+// New panic on invalid option, use NewWithError for options from input
+func New(opts ...Option) *SortedSet {
+	set, err := NewWithError(opts...)
+	if err != nil {
+		panic(err)
 	}
-	p := &page{}
-	set := &SortedSet{}
-	set.pages = make([]*page, 0, capacity)
-	set.pages = append(set.pages, p)
 	return set
 }
 
+// NewWithError create sorted set, return error on invalid option
+func NewWithError(opts ...Option) (*SortedSet, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		if err := o.apply(opt); err != nil {
+			return nil, err
+		}
+	}
+	if o.adaptive && o.pageSize < o.minPage {
+		o.pageSize = o.minPage
+	}
+	if o.adaptive && o.pageSize > o.maxPage {
+		o.pageSize = o.maxPage
+	}
+	set := &SortedSet{opts: o, name: o.name, observer: o.observer, seed: maphash.MakeSeed(), gen: nextGen()}
+	if o.storage == StorageArena {
+		set.arena = &arena{}
+	}
+	set.pages = make([]*page, 0, o.capacity)
+	set.pages = append(set.pages, set.newPage(o.pageSize))
+	set.maxSize = o.pageSize
+	return set, nil
+}
+
+func (set *SortedSet) newPage(size int) *page {
+	p := &page{keys: set.newKeyStore(size), size: size, gen: set.gen}
+	if set.counted {
+		p.counts = make([]int, 0, size)
+	}
+	set.rebuild(p)
+	return p
+}
+
 // Put will add key in set, if not present
 func (set *SortedSet) Put(key string) {
-	set.Lock()
-	defer set.Unlock()
+	start := set.lock(OpPut)
+	defer set.unlock(OpPut, start)
 	set.put(key)
 }
 
+// Len return number of keys in set
+func (set *SortedSet) Len() int {
+	set.RLock()
+	defer set.RUnlock()
+	return set.count
+}
+
 func (set *SortedSet) idxPage(key string, byPrefix bool) int {
 	//fmt.Printf("Add %s %+v\n", key, set)
 	N := len(set.pages) * 2
@@ -94,80 +147,101 @@ func (set *SortedSet) idxPage(key string, byPrefix bool) int {
 // Put will add key in set, if not present
 func (set *SortedSet) put(key string) {
 	idx := set.idxPage(key, false)
-	if set.pages[idx].numItems == pageSize-1 {
-		set.split(idx)
+	p := set.own(idx)
+	if p.numItems == p.size-1 && !set.grow(p) {
+		set.split(idx, set.splitPoint(p, key))
 		set.put(key)
 		return
 	}
-	set.pages[idx].add(key)
+	if p.add(key) {
+		set.count++
+	}
+}
+
+// key return key at i
+func (p *page) key(i int) string {
+	return p.keys.key(i)
 }
 
 func (p *page) idxItem(key string) int {
 	//fmt.Println("add", key)
+	if s, ok := p.keys.(keySearcher); ok {
+		return s.search(p.numItems, key)
+	}
 	i := sort.Search(p.numItems, func(n int) bool {
-		return p.items[n] <= key
+		return p.key(n) <= key
 	})
 	return i
 }
 
-func (p *page) add(key string) *page {
-	i := sort.Search(p.numItems, func(n int) bool {
-		return p.items[n] <= key
-	})
+// add insert key in page, return false if key is present
+func (p *page) add(key string) bool {
+	i := p.idxItem(key)
 	//fmt.Println("page i", i, key, p.items[1] == key)
-	if i < p.numItems && p.items[i] == key {
+	if i < p.numItems && p.key(i) == key {
 		// key is present at data[i], nothing to do here
-		return p
+		return false
 	}
-	if i == p.numItems {
-		// not found, new min, append at the end
-		p.items[i] = key
-		p.max = p.items[0]
-		p.min = key
-		p.numItems++
-		//fmt.Println("data i == p.numItems:", p.items, p.min, p.max, p.numItems)
-		return p
+	p.keys.insert(p.numItems, i, key)
+	p.numItems++
+	if p.counts != nil {
+		p.counts = append(p.counts, 0)
+		copy(p.counts[i+1:], p.counts[i:])
+		p.counts[i] = 0
+	}
+	p.bytes += len(key)
+	p.sum += keyHash(key)
+	if p.filter != nil {
+		p.filter.add(key)
 	}
-
-	//insert or prepend
 	if i == 0 {
 		//prepend, new max
-		p.max = key
-		p.min = p.items[p.numItems-1]
+		p.max = p.key(0)
 	}
-	//insert - not modify min/max
-	copy(p.items[i+1:p.numItems+1], p.items[i:p.numItems])
-	p.items[i] = key
-	p.numItems++
-	return p
+	if i == p.numItems-1 {
+		// append at the end, new min
+		p.min = p.key(i)
+	}
+	return true
 }
 
-func (set *SortedSet) split(idx int) {
+// split owned page at mid, keys from mid are moved to new page
+func (set *SortedSet) split(idx, mid int) {
 	//fmt.Printf("set before split:%+v\n", set)
 	//example data: 015 014 013 012 011 010 009 008 007 006 005...
 	p := set.pages[idx]
 	//fmt.Println("data before:", p.items, p.min, p.max, p.numItems)
-	mid := (pageSize - 1) / 2 //127
-	pRight := &page{}
-	copy(pRight.items[:mid+1], p.items[mid:])
+	pRight := &page{keys: p.keys.split(p.numItems, mid), size: p.size, gen: set.gen}
 	//0:126 127:254
 	//right
-	pRight.max = p.items[mid]          //127
-	pRight.min = p.items[p.numItems-1] //254
-	pRight.numItems = mid + 1          //128
+	pRight.numItems = p.numItems - mid //128
+	pRight.max = pRight.key(0)
+	pRight.min = pRight.key(pRight.numItems - 1)
+	for i := 0; i < pRight.numItems; i++ {
+		pRight.bytes += len(pRight.key(i))
+		pRight.sum += keyHash(pRight.key(i))
+	}
 	//left
 	p.numItems = mid //254 -> 127
-	p.max = p.items[0]
-	p.min = p.items[mid-1] //[126]
-	for i := mid; i < pageSize; i++ {
-		p.items[i] = ""
+	p.max = p.key(0)
+	p.min = p.key(mid - 1) //[126]
+	p.bytes -= pRight.bytes
+	p.sum -= pRight.sum
+	if p.counts != nil {
+		pRight.counts = append(make([]int, 0, p.size), p.counts[mid:]...)
+		p.counts = p.counts[:mid]
 	}
+	set.rebuild(p)
+	set.rebuild(pRight)
 	//grow pages
 	set.pages = append(set.pages, nil)
 	//copy
 	copy(set.pages[idx+1:], set.pages[idx:])
 	set.pages[idx] = p
 	set.pages[idx+1] = pRight
+	if set.observer != nil {
+		set.observer.ObserveSplit(set.name)
+	}
 	/*
 		fmt.Println("data left:", p.items, p.min, p.max, p.numItems)
 		fmt.Println("data right:", pRight.items, pRight.min, pRight.max, pRight.numItems)
@@ -175,19 +249,173 @@ func (set *SortedSet) split(idx int) {
 	*/
 }
 
-// Keys return all keys in descending order
+// splitPoint return index to split full page before key insert
+func (set *SortedSet) splitPoint(p *page, key string) int {
+	if set.opts.adaptive {
+		// sequential inserts leave full pages behind
+		switch p.idxItem(key) {
+		case 0:
+			return 1
+		case p.numItems:
+			return p.numItems - 1
+		}
+	}
+	return (p.size - 1) / 2
+}
+
+// adaptiveSize return page size for average key length in page
+func (set *SortedSet) adaptiveSize(p *page) int {
+	avg := 1
+	if p.numItems > 0 && p.bytes > p.numItems {
+		avg = p.bytes / p.numItems
+	}
+	size := set.opts.pageSize * adaptiveKeyLen / avg
+	if size < set.opts.minPage {
+		return set.opts.minPage
+	}
+	if size > set.opts.maxPage {
+		return set.opts.maxPage
+	}
+	return int(nextPowerOf2(uint32(size)))
+}
+
+// grow full page with short keys instead of split
+func (set *SortedSet) grow(p *page) bool {
+	if !set.opts.adaptive || p.size >= set.opts.maxPage || set.adaptiveSize(p) <= p.size {
+		return false
+	}
+	p.keys.resize(p.numItems, p.size*2)
+	p.size *= 2
+	if p.size > set.maxSize {
+		set.maxSize = p.size
+	}
+	set.rebuild(p)
+	return true
+}
+
+// shrink underused page with long keys
+func (set *SortedSet) shrink(p *page) {
+	if !set.opts.adaptive || p.size <= set.opts.minPage || p.numItems >= p.size/4 || set.adaptiveSize(p) > p.size/2 {
+		return
+	}
+	p.keys.resize(p.numItems, p.size/2)
+	p.size /= 2
+	set.rebuild(p)
+}
+
+func (set *SortedSet) checkSize(p *page) error {
+	if !set.opts.adaptive {
+		if p.size != set.opts.pageSize {
+			return fmt.Errorf("size is %d, want %d", p.size, set.opts.pageSize)
+		}
+		return nil
+	}
+	if p.size < set.opts.minPage || p.size > set.opts.maxPage || p.size != int(nextPowerOf2(uint32(p.size))) {
+		return fmt.Errorf("size is %d, want power of 2 in %d..%d", p.size, set.opts.minPage, set.opts.maxPage)
+	}
+	if p.size > set.maxSize {
+		return fmt.Errorf("size is %d, greater than max size %d", p.size, set.maxSize)
+	}
+	return nil
+}
+
+// Keys return all keys in set order, descending by default
 func (set *SortedSet) Keys() (result []string) {
+	start := set.rlock(OpKeys)
+	defer set.runlock(OpKeys, start)
+	result = make([]string, 0, set.count)
+	if set.opts.order == Ascending {
+		for i := len(set.pages) - 1; i >= 0; i-- {
+			p := set.pages[i]
+			for j := p.numItems - 1; j >= 0; j-- {
+				result = append(result, p.key(j))
+			}
+		}
+		return result
+	}
+	for _, p := range set.pages {
+		for i := 0; i < p.numItems; i++ {
+			result = append(result, p.key(i))
+		}
+	}
+	return result
+}
+
+// Validate checks the page index and returns an error describing
+// the first violated invariant, or nil if the set is consistent
+func (set *SortedSet) Validate() error {
 	set.RLock()
 	defer set.RUnlock()
-	for _, p := range set.pages {
-		for i, key := range p.items {
-			if i >= p.numItems {
-				break
+	return set.validate()
+}
+
+func (set *SortedSet) validate() error {
+	if len(set.pages) == 0 {
+		return errors.New("sortedset: no pages")
+	}
+	count := 0
+	for i, p := range set.pages {
+		if p == nil {
+			return fmt.Errorf("sortedset: page %d is nil", i)
+		}
+		if p.numItems < 0 || p.numItems > p.size-1 {
+			return fmt.Errorf("sortedset: page %d has %d items, want 0..%d", i, p.numItems, p.size-1)
+		}
+		if err := set.checkSize(p); err != nil {
+			return fmt.Errorf("sortedset: page %d %v", i, err)
+		}
+		if p.numItems == 0 {
+			if len(set.pages) > 1 {
+				return fmt.Errorf("sortedset: page %d is empty", i)
+			}
+			if p.min != "" || p.max != "" {
+				return fmt.Errorf("sortedset: empty page %d has max %q min %q", i, p.max, p.min)
+			}
+		} else {
+			if p.max != p.key(0) {
+				return fmt.Errorf("sortedset: page %d max %q, first item %q", i, p.max, p.key(0))
+			}
+			if p.min != p.key(p.numItems-1) {
+				return fmt.Errorf("sortedset: page %d min %q, last item %q", i, p.min, p.key(p.numItems-1))
+			}
+		}
+		if err := p.keys.check(p.numItems, p.size); err != nil {
+			return fmt.Errorf("sortedset: page %d: %v", i, err)
+		}
+		if err := set.checkFilter(p); err != nil {
+			return fmt.Errorf("sortedset: page %d: %v", i, err)
+		}
+		for j := 1; j < p.numItems; j++ {
+			if p.key(j-1) <= p.key(j) {
+				return fmt.Errorf("sortedset: page %d not descending at item %d: %q <= %q", i, j, p.key(j-1), p.key(j))
 			}
-			result = append(result, key)
+		}
+		if i > 0 && set.pages[i-1].min <= p.max {
+			return fmt.Errorf("sortedset: page %d min %q overlaps page %d max %q", i-1, set.pages[i-1].min, i, p.max)
+		}
+		count += p.numItems
+		bytes, sum := 0, uint64(0)
+		for j := 0; j < p.numItems; j++ {
+			bytes += len(p.key(j))
+			sum += keyHash(p.key(j))
+		}
+		if bytes != p.bytes {
+			return fmt.Errorf("sortedset: page %d hold %d bytes, want %d", i, p.bytes, bytes)
+		}
+		if sum != p.sum {
+			return fmt.Errorf("sortedset: page %d hash sum %x, want %x", i, p.sum, sum)
+		}
+		if err := set.checkCounts(p); err != nil {
+			return fmt.Errorf("sortedset: page %d: %v", i, err)
 		}
 	}
-	return result
+	if count != set.count {
+		return fmt.Errorf("sortedset: count is %d, pages hold %d items", set.count, count)
+	}
+	if set.arena != nil {
+		return set.checkArena()
+	}
+	return nil
 }
 
 func (set *SortedSet) print() (result []string) {
@@ -223,43 +451,28 @@ func (bkt *BucketStore) Put(key string) {
 	bkt.Set.Put(bkt.Name + key)
 }
 
-// Keys return all keys from bucket, with limit offset
+// Keys return all keys from bucket in set order, with limit offset
 // if limit <= 0 - no limit
 // if offset <= 0 - no offset
 func (bkt *BucketStore) Keys(limit, offset int) (result []string) {
-	bkt.Set.RLock()
-	defer bkt.Set.RUnlock()
-	lenName := len(bkt.Name)
-	res, idxPage, idxItem := bkt.last()
-	if !strings.HasPrefix(res, bkt.Name) {
-		return
-	}
-	stop := false
-	//fmt.Println(bkt.Name, idxPage, idxItem)
-	for i := idxPage; i < len(bkt.Set.pages); i++ { //_, p := range bkt.Set.pages {
-		if stop {
+	start := bkt.Set.rlock(OpKeys)
+	defer bkt.Set.runlock(OpKeys, start)
+	set := bkt.Set
+	order := set.opts.order
+	idxPage, idxItem := set.seekPrefix(bkt.Name, "", false, order)
+	for ; ; idxPage, idxItem = set.step(idxPage, idxItem, order) {
+		key, ok := set.at(idxPage, idxItem)
+		if !ok || !strings.HasPrefix(key, bkt.Name) {
 			break
 		}
-		for j := idxItem; j < bkt.Set.pages[i].numItems; j++ { //, key := range p.items[i] {
-			key := bkt.Set.pages[i].items[j]
-			if strings.HasPrefix(key, bkt.Name) {
-				if offset <= 0 {
-					if limit > 0 && len(result) == limit {
-						stop = true
-						break
-					}
-					result = append(result, key[lenName:])
-				} else {
-					if offset >= 0 {
-						offset--
-					}
-				}
-			} else {
-				stop = true
-				break
-			}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && len(result) == limit {
+			break
 		}
-		idxItem = 0
+		result = append(result, key[len(bkt.Name):])
 	}
 	return result
 }
@@ -275,13 +488,14 @@ func (bkt *BucketStore) last() (result string, idxPage, idxItem int) {
 	//Page
 	p := set.pages[idxPage]
 	i := sort.Search(p.numItems, func(n int) bool {
-		if len(p.items[n]) > len(key) {
-			return p.items[n][:len(key)] <= key
+		item := p.key(n)
+		if len(item) > len(key) {
+			return item[:len(key)] <= key
 		}
-		return p.items[n] <= key
+		return item <= key
 	})
 
-	if i < p.numItems && p.items[i] == key {
+	if i < p.numItems && p.key(i) == key {
 		// key is present at data[i], nothing to do here
 		idxItem = i
 	}
@@ -294,7 +508,7 @@ func (bkt *BucketStore) last() (result string, idxPage, idxItem int) {
 	idxItem = i
 	result = ""
 	if idxItem < p.numItems {
-		result = p.items[idxItem]
+		result = p.key(idxItem)
 	}
 
 	return result, idxPage, idxItem
@@ -325,21 +539,30 @@ func (bkt *BucketStore) Prev() (key string) {
 	bkt.Set.RLock()
 	defer bkt.Set.RUnlock()
 
+	// pages may be dropped by delete after Last, check bounds
+	if bkt.idxPage < 0 || bkt.idxPage >= len(bkt.Set.pages) {
+		return ""
+	}
 	p := bkt.Set.pages[bkt.idxPage]
 	if p == nil {
 		return ""
 	}
 	if bkt.idxItem < p.numItems-1 {
 		bkt.idxItem++
-		if !strings.HasPrefix(p.items[bkt.idxItem], bkt.Name) {
+		result := p.key(bkt.idxItem)
+		if !strings.HasPrefix(result, bkt.Name) {
 			return ""
 		}
-		return p.items[bkt.idxItem][len(bkt.Name):]
+		return result[len(bkt.Name):]
 	}
 	if bkt.idxPage < len(bkt.Set.pages)-1 {
 		bkt.idxPage++
 		bkt.idxItem = 0
-		result := bkt.Set.pages[bkt.idxPage].items[bkt.idxItem]
+		next := bkt.Set.pages[bkt.idxPage]
+		if next == nil || next.numItems == 0 {
+			return ""
+		}
+		result := next.key(bkt.idxItem)
 		if !strings.HasPrefix(result, bkt.Name) {
 			return ""
 		}
@@ -362,12 +585,13 @@ func (c *Cursor) seek() (key string) {
 func (set *SortedSet) has(key string) bool {
 	idx := set.idxPage(key, false)
 	p := set.pages[idx]
+	if p.filter != nil && !p.filter.has(key) {
+		return false
+	}
 
-	i := sort.Search(p.numItems, func(n int) bool {
-		return p.items[n] <= key
-	})
+	i := p.idxItem(key)
 	//fmt.Println("page i", i, key, p.items[1] == key)
-	if i < p.numItems && p.items[i] == key {
+	if i < p.numItems && p.key(i) == key {
 		// key is present at data[i], nothing to do here
 		return true
 	}
@@ -376,8 +600,8 @@ func (set *SortedSet) has(key string) bool {
 
 // Has return true if key in set
 func (set *SortedSet) Has(key string) bool {
-	set.Lock()
-	defer set.Unlock()
+	start := set.rlock(OpHas)
+	defer set.runlock(OpHas, start)
 	return set.has(key)
 }
 
@@ -386,39 +610,51 @@ func (set *SortedSet) delete(key string) bool {
 	// sort desc
 	idx := set.idxPage(key, false)
 
-	//p := set.pages[idx]
-	i := sort.Search(set.pages[idx].numItems, func(n int) bool {
-		return set.pages[idx].items[n] <= key
-	})
+	p := set.pages[idx]
+	i := p.idxItem(key)
 	//fmt.Println("page i", i, key, p.items[1] == key)
-	if i < set.pages[idx].numItems && set.pages[idx].items[i] == key {
-		//delete
-		//set.pages[idx].
-		copy(set.pages[idx].items[i:], set.pages[idx].items[i+1:])
-		if i == set.pages[idx].numItems-1 {
-			if i == 0 {
-				//delete set.pages[idx]
-				//fmt.Println("delete set.pages[idx]")
-				set.pages[idx].max = ""
-				set.pages[idx].min = ""
-			} else {
-				//last elem
-				set.pages[idx].min = set.pages[idx].items[i-1]
-				//upd index
-			}
+	if i == p.numItems || p.key(i) != key {
+		return false
+	}
+	p = set.own(idx)
+	p.keys.remove(p.numItems, i)
+	p.numItems--
+	if p.counts != nil {
+		p.counts = append(p.counts[:i], p.counts[i+1:]...)
+	}
+	p.bytes -= len(key)
+	p.sum -= keyHash(key)
+	set.count--
+	if p.numItems == 0 {
+		p.max = ""
+		p.min = ""
+		if len(set.pages) > 1 {
+			// drop empty page, it would break binary search on index
+			copy(set.pages[idx:], set.pages[idx+1:])
+			set.pages[len(set.pages)-1] = nil
+			set.pages = set.pages[:len(set.pages)-1]
 		}
+	} else {
 		if i == 0 {
-			set.pages[idx].max = set.pages[idx].items[i]
+			p.max = p.key(0)
 		}
-		set.pages[idx].numItems--
-		//fmt.Printf("\n%s %+v\n", key, set.pages[idx])
-		return true
+		if i == p.numItems {
+			//last elem
+			p.min = p.key(i - 1)
+		}
+		set.removed(p)
+		set.shrink(p)
 	}
-	return false
+	if set.arena != nil && set.arena.needCompact() {
+		set.compact()
+	}
+	//fmt.Printf("\n%s %+v\n", key, set.pages[idx])
+	return true
 }
 
+// Delete remove key from set, return true if key was present
 func (set *SortedSet) Delete(key string) bool {
-	set.Lock()
-	defer set.Unlock()
+	start := set.lock(OpDelete)
+	defer set.unlock(OpDelete, start)
 	return set.delete(key)
 }
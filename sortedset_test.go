@@ -279,6 +279,7 @@ func testRand(N int, t *testing.T) {
 	}
 	result := set.Keys()
 	//set.print()
+	assert.NoError(t, set.Validate())
 
 	assert.Equal(t, len(keys), len(result))
 	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
@@ -387,6 +388,7 @@ func TestParallel(t *testing.T) {
 	})
 	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
 	assert.Equal(t, keys, bkt.Keys(0, 0))
+	assert.NoError(t, set.Validate())
 }
 
 func TestBucket(t *testing.T) {
@@ -435,6 +437,7 @@ func TestBucket(t *testing.T) {
 		first = k
 	}
 	assert.Equal(t, "000", first)
+	assert.NoError(t, set.Validate())
 }
 
 func TestCursor(t *testing.T) {
@@ -475,4 +478,94 @@ func TestDelete(t *testing.T) {
 	assert.Equal(t, "3", c.Last())
 	set.Delete("3")
 	assert.Equal(t, "", c.Last())
+	assert.NoError(t, set.Validate())
+}
+
+func TestCursorAfterDelete(t *testing.T) {
+	set := New()
+	keys := randKeys(300)
+	bkt := Bucket(set, "a")
+	for _, key := range keys {
+		bkt.Put(key)
+	}
+	c := Bucket(set, "a00").Cursor()
+	assert.Equal(t, "9", c.Last())
+	for _, key := range keys {
+		set.Delete("a" + key)
+	}
+	assert.Equal(t, "", c.Prev())
+	assert.Equal(t, "", c.Last())
+
+	// cursor stays usable after partial deletes
+	for _, key := range keys {
+		bkt.Put(key)
+	}
+	c = bkt.Cursor()
+	assert.Equal(t, "299", c.Last())
+	for _, key := range keys[:250] {
+		set.Delete("a" + key)
+	}
+	for k := c.Prev(); k != ""; k = c.Prev() {
+		assert.True(t, set.Has("a"+k))
+	}
+	assert.NoError(t, set.Validate())
+}
+
+func TestRandOps(t *testing.T) {
+	for N := 10; N < 5000; N = N * 3 {
+		set := New()
+		all := make(map[string]bool)
+		keys := randKeysBin(N)
+		for round := 0; round < 4; round++ {
+			for _, key := range keys {
+				if rnd.Intn(3) == 0 {
+					assert.Equal(t, all[key], set.Delete(key))
+					delete(all, key)
+				} else {
+					set.Put(key)
+					all[key] = true
+				}
+			}
+			if err := set.Validate(); err != nil {
+				t.Fatalf("N:%d round:%d %v", N, round, err)
+			}
+			var expect []string
+			for key := range all {
+				expect = append(expect, key)
+			}
+			sort.Sort(sort.Reverse(sort.StringSlice(expect)))
+			assert.Equal(t, len(expect), len(set.Keys()))
+			_, eq := stringsEquals(set.Keys(), expect)
+			assert.True(t, eq)
+		}
+		for key := range all {
+			assert.True(t, set.Delete(key))
+		}
+		assert.NoError(t, set.Validate())
+		assert.Equal(t, 0, len(set.Keys()))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	set := New()
+	assert.NoError(t, set.Validate())
+	for i := 0; i < 300; i++ {
+		set.Put(fmt.Sprintf("%03d", i))
+	}
+	assert.NoError(t, set.Validate())
+
+	items := set.pages[0].keys.(*arrayStore).items
+	items[1], items[2] = items[2], items[1]
+	assert.Error(t, set.Validate())
+	items[1], items[2] = items[2], items[1]
+
+	set.pages[1].max = "999"
+	assert.Error(t, set.Validate())
+	set.pages[1].max = set.pages[1].key(0)
+
+	items = set.pages[1].keys.(*arrayStore).items
+	items[defaultPageSize-1] = "x"
+	assert.Error(t, set.Validate())
+	items[defaultPageSize-1] = ""
+	assert.NoError(t, set.Validate())
 }
@@ -0,0 +1,295 @@
+package sortedset
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Storage is a layout of keys inside page
+type Storage int
+
+const (
+	// StorageArray keep keys as array of strings, default and fastest
+	StorageArray Storage = iota
+	// StoragePrefix keep keys front-coded in one buffer per page:
+	// length of prefix shared with previous key and suffix.
+	// It use less memory for keys with common prefixes, like bucket keys,
+	// but keys are decoded on every access
+	StoragePrefix
+	// StorageArena keep key bytes in large pointer-free slabs shared by
+	// all pages, pages reference keys by offset and length. GC do not
+	// trace keys, dead bytes are compacted after deletes
+	StorageArena
+)
+
+// keyStore hold keys of page in descending order.
+// Page track number of keys and pass it as n
+type keyStore interface {
+	// key return key at i
+	key(i int) string
+	// insert key at i, shift keys after it
+	insert(n, i int, key string)
+	// remove key at i, shift keys after it
+	remove(n, i int)
+	// split keep keys before mid and return store with the rest
+	split(n, mid int) keyStore
+	// resize store to hold size keys
+	resize(n, size int)
+	// check storage invariants for page of size
+	check(n, size int) error
+	// clone return copy of store for copy-on-write page
+	clone() keyStore
+}
+
+// keySearcher is implemented by stores with faster search than key by key
+type keySearcher interface {
+	// search return index of the first key <= key
+	search(n int, key string) int
+}
+
+func (set *SortedSet) newKeyStore(size int) keyStore {
+	switch set.opts.storage {
+	case StoragePrefix:
+		return &prefixStore{}
+	case StorageArena:
+		return &arenaStore{arena: set.arena, refs: make([]keyRef, size)}
+	}
+	return &arrayStore{items: make([]string, size)}
+}
+
+// arrayStore keep keys in array of page size, unused items are empty
+type arrayStore struct {
+	items []string
+}
+
+func (a *arrayStore) key(i int) string {
+	return a.items[i]
+}
+
+func (a *arrayStore) insert(n, i int, key string) {
+	copy(a.items[i+1:n+1], a.items[i:n])
+	a.items[i] = key
+}
+
+func (a *arrayStore) remove(n, i int) {
+	copy(a.items[i:n], a.items[i+1:n])
+	a.items[n-1] = ""
+}
+
+func (a *arrayStore) split(n, mid int) keyStore {
+	right := &arrayStore{items: make([]string, len(a.items))}
+	copy(right.items, a.items[mid:n])
+	for i := mid; i < n; i++ {
+		a.items[i] = ""
+	}
+	return right
+}
+
+func (a *arrayStore) resize(n, size int) {
+	items := make([]string, size)
+	copy(items, a.items[:n])
+	a.items = items
+}
+
+func (a *arrayStore) clone() keyStore {
+	return &arrayStore{items: append([]string(nil), a.items...)}
+}
+
+func (a *arrayStore) check(n, size int) error {
+	if len(a.items) != size {
+		return fmt.Errorf("%d items in page of size %d", len(a.items), size)
+	}
+	for i := n; i < len(a.items); i++ {
+		if a.items[i] != "" {
+			return fmt.Errorf("padding item %d is %q", i, a.items[i])
+		}
+	}
+	return nil
+}
+
+// restartInterval is how often prefixStore store full key,
+// key access decode at most restartInterval keys
+const restartInterval = 16
+
+// prefixStore keep keys front-coded: every key is uvarint length of prefix
+// shared with previous key, uvarint length of suffix and suffix.
+// Every restartInterval key is stored in full, restarts hold their offsets
+type prefixStore struct {
+	buf      []byte
+	restarts []uint32
+}
+
+// prefixReader decode keys one by one
+type prefixReader struct {
+	buf []byte
+	off int
+	key []byte
+}
+
+// reader return reader positioned at restart block
+func (s *prefixStore) reader(block int) prefixReader {
+	r := prefixReader{buf: s.buf}
+	if block < len(s.restarts) {
+		r.off = int(s.restarts[block])
+	} else {
+		r.off = len(s.buf)
+	}
+	return r
+}
+
+// next decode next key into r.key
+func (r *prefixReader) next() {
+	shared, l := binary.Uvarint(r.buf[r.off:])
+	r.off += l
+	suffix, l := binary.Uvarint(r.buf[r.off:])
+	r.off += l
+	r.key = append(r.key[:shared], r.buf[r.off:r.off+int(suffix)]...)
+	r.off += int(suffix)
+}
+
+func (s *prefixStore) key(i int) string {
+	r := s.reader(i / restartInterval)
+	for j := i &^ (restartInterval - 1); j <= i; j++ {
+		r.next()
+	}
+	return string(r.key)
+}
+
+func (s *prefixStore) search(n int, key string) int {
+	// restart keys are stored in full, find the first restart key <= key
+	b := sort.Search(len(s.restarts), func(b int) bool {
+		off := int(s.restarts[b]) + 1
+		suffix, l := binary.Uvarint(s.buf[off:])
+		off += l
+		return string(s.buf[off:off+int(suffix)]) <= key
+	})
+	if b == 0 {
+		return 0
+	}
+	// scan block before it
+	var scratch [64]byte
+	r := s.reader(b - 1)
+	r.key = scratch[:0]
+	i := (b - 1) * restartInterval
+	for ; i < n && i < b*restartInterval; i++ {
+		r.next()
+		if string(r.key) <= key {
+			return i
+		}
+	}
+	return i
+}
+
+// prefixWriter encode keys into new prefixStore
+type prefixWriter struct {
+	buf      []byte
+	restarts []uint32
+	prev     []byte
+	n        int
+}
+
+func (w *prefixWriter) add(key []byte) {
+	shared := 0
+	if w.n%restartInterval == 0 {
+		w.restarts = append(w.restarts, uint32(len(w.buf)))
+	} else {
+		for shared < len(key) && shared < len(w.prev) && key[shared] == w.prev[shared] {
+			shared++
+		}
+	}
+	w.buf = binary.AppendUvarint(w.buf, uint64(shared))
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(key)-shared))
+	w.buf = append(w.buf, key[shared:]...)
+	w.prev = append(w.prev[:0], key...)
+	w.n++
+}
+
+func (w *prefixWriter) store() prefixStore {
+	return prefixStore{buf: w.buf, restarts: w.restarts}
+}
+
+// rewrite encode keys again starting from restart block with key inserted
+// at i (insert) or removed from i
+func (s *prefixStore) rewrite(n, i int, key []byte, insert bool) {
+	block := i / restartInterval
+	if block > len(s.restarts) {
+		block = len(s.restarts)
+	}
+	r := s.reader(block)
+	// keys before block are not changed
+	w := prefixWriter{n: block * restartInterval}
+	w.buf = make([]byte, r.off, len(s.buf)+len(key)+2*binary.MaxVarintLen32)
+	copy(w.buf, s.buf[:r.off])
+	w.restarts = make([]uint32, block, len(s.restarts)+1)
+	copy(w.restarts, s.restarts[:block])
+	for j := block * restartInterval; j < n; j++ {
+		r.next()
+		if j == i {
+			if !insert {
+				continue
+			}
+			w.add(key)
+		}
+		w.add(r.key)
+	}
+	if insert && i == n {
+		w.add(key)
+	}
+	*s = w.store()
+}
+
+func (s *prefixStore) insert(n, i int, key string) {
+	s.rewrite(n, i, []byte(key), true)
+}
+
+func (s *prefixStore) remove(n, i int) {
+	s.rewrite(n, i, nil, false)
+}
+
+func (s *prefixStore) split(n, mid int) keyStore {
+	var left, right prefixWriter
+	r := s.reader(0)
+	for j := 0; j < n; j++ {
+		r.next()
+		if j < mid {
+			left.add(r.key)
+		} else {
+			right.add(r.key)
+		}
+	}
+	*s = left.store()
+	rs := right.store()
+	return &rs
+}
+
+func (s *prefixStore) resize(n, size int) {}
+
+// clone share buffers, they are never changed in place
+func (s *prefixStore) clone() keyStore {
+	c := *s
+	return &c
+}
+
+func (s *prefixStore) check(n, size int) error {
+	if len(s.restarts) != (n+restartInterval-1)/restartInterval {
+		return fmt.Errorf("%d restarts for %d keys", len(s.restarts), n)
+	}
+	r := s.reader(0)
+	for i := 0; i < n; i++ {
+		if i%restartInterval == 0 {
+			if int(s.restarts[i/restartInterval]) != r.off {
+				return fmt.Errorf("restart %d at offset %d, key at %d", i/restartInterval, s.restarts[i/restartInterval], r.off)
+			}
+			if s.buf[r.off] != 0 {
+				return errors.New("restart key is not stored in full")
+			}
+		}
+		r.next()
+	}
+	if r.off != len(s.buf) {
+		return fmt.Errorf("%d bytes after last key", len(s.buf)-r.off)
+	}
+	return nil
+}
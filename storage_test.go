@@ -0,0 +1,178 @@
+package sortedset
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var storages = []struct {
+	name    string
+	storage Storage
+}{
+	{"Array", StorageArray},
+	{"Prefix", StoragePrefix},
+	{"Arena", StorageArena},
+}
+
+func TestStorage(t *testing.T) {
+	for _, s := range storages {
+		t.Run(s.name, func(t *testing.T) {
+			set := New(WithStorage(s.storage))
+			users := Bucket(set, "tenant:0001:user:")
+			all := make(map[string]bool)
+			keys := randKeysBin(3000)
+			for round := 0; round < 3; round++ {
+				for i, key := range keys {
+					if (i+round)%4 == 0 {
+						assert.Equal(t, all[key], set.Delete("tenant:0001:user:"+key))
+						delete(all, key)
+					} else {
+						users.Put(key)
+						all[key] = true
+					}
+				}
+				assert.NoError(t, set.Validate())
+				var expect []string
+				for key := range all {
+					expect = append(expect, key)
+				}
+				sort.Sort(sort.Reverse(sort.StringSlice(expect)))
+				assert.Equal(t, expect, users.Keys(0, 0))
+				assert.Equal(t, len(expect), set.Len())
+				for _, key := range expect[:10] {
+					assert.True(t, set.Has("tenant:0001:user:"+key))
+				}
+			}
+			c := users.Cursor()
+			n := 0
+			for k := c.Last(); k != ""; k = c.Prev() {
+				n++
+			}
+			assert.Equal(t, len(all), n)
+		})
+	}
+}
+
+func TestPrefixStoreCheck(t *testing.T) {
+	set := New(WithStorage(StoragePrefix))
+	for i := 0; i < 100; i++ {
+		set.Put(fmt.Sprintf("bucket:%03d", i))
+	}
+	assert.NoError(t, set.Validate())
+	s := set.pages[0].keys.(*prefixStore)
+	s.restarts[1]++
+	assert.Error(t, set.Validate())
+	s.restarts[1]--
+	s.buf = append(s.buf, 0)
+	assert.Error(t, set.Validate())
+}
+
+func TestArenaCompact(t *testing.T) {
+	set := New(WithStorage(StorageArena))
+	for i := 0; i < 10000; i++ {
+		set.Put(fmt.Sprintf("key:%06d", i))
+	}
+	max := set.Keys()[0]
+	assert.Equal(t, 100000, set.arena.live)
+	slabs := len(set.arena.slabs)
+	for i := 0; i < 9000; i++ {
+		assert.True(t, set.Delete(fmt.Sprintf("key:%06d", i)))
+		assert.True(t, set.arena.dead <= set.arena.live || set.arena.dead <= minSlabSize)
+	}
+	assert.NoError(t, set.Validate())
+	assert.True(t, len(set.arena.slabs) < slabs)
+	assert.Equal(t, 10000, set.arena.live)
+	// strings returned before compaction are still valid
+	assert.Equal(t, "key:009999", max)
+	assert.Equal(t, "key:009000", set.Keys()[999])
+
+	set.Delete("key:009999")
+	set.Compact()
+	assert.Equal(t, 0, set.arena.dead)
+	assert.NoError(t, set.Validate())
+	assert.Equal(t, 999, len(set.Keys()))
+}
+
+func TestArenaClone(t *testing.T) {
+	set := New(WithStorage(StorageArena))
+	for i := 0; i < 2000; i++ {
+		c := set.Clone()
+		set.Put(fmt.Sprintf("key:%06d", i))
+		c.Put(fmt.Sprintf("clone:%06d", i))
+		assert.Equal(t, i, c.Len()-1)
+	}
+	// 20000 bytes of keys, not a slab per clone
+	assert.True(t, len(set.arena.slabs) <= 4, "%d slabs", len(set.arena.slabs))
+	assert.NoError(t, set.Validate())
+
+	// clone start new slab after sealed one, not smaller than minSlabSize
+	small := New(WithStorage(StorageArena))
+	small.Put("a")
+	c := small.Clone()
+	c.Put("b")
+	assert.Equal(t, 2, len(c.arena.slabs))
+	assert.Equal(t, minSlabSize, cap(c.arena.slabs[1]))
+	assert.Equal(t, []string{"b", "a"}, c.Keys())
+	assert.Equal(t, []string{"a"}, small.Keys())
+}
+
+// go test -bench StorageMem -benchtime 1000000x
+func BenchmarkStorageMem(b *testing.B) {
+	for _, s := range storages {
+		b.Run(s.name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			set := New(WithStorage(s.storage))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				set.Put(fmt.Sprintf("tenant:%04d:users:%012d", i%16, i))
+			}
+			b.StopTimer()
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-B/key")
+			runtime.KeepAlive(set)
+		})
+	}
+}
+
+// go test -bench StorageGC -benchtime 20x
+func BenchmarkStorageGC(b *testing.B) {
+	for _, s := range storages {
+		b.Run(s.name, func(b *testing.B) {
+			set := New(WithStorage(s.storage))
+			for i := 0; i < 300000; i++ {
+				set.Put(fmt.Sprintf("tenant:%04d:users:%012d", i%16, i))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			runtime.KeepAlive(set)
+		})
+	}
+}
+
+func BenchmarkStorageHas(b *testing.B) {
+	for _, s := range storages {
+		b.Run(s.name, func(b *testing.B) {
+			set := New(WithStorage(s.storage))
+			keys := make([]string, b.N)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("tenant:%04d:users:%012d", i%16, i)
+				set.Put(keys[i])
+			}
+			b.ResetTimer()
+			for _, key := range keys {
+				if !set.Has(key) {
+					b.Fatal("bad news")
+				}
+			}
+		})
+	}
+}
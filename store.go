@@ -0,0 +1,595 @@
+package sortedset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMemtableSize = 64 << 10
+	defaultMaxRuns      = 4
+
+	walFile      = "wal.log"
+	manifestFile = "MANIFEST"
+)
+
+var (
+	// ErrClosed returned by operations on closed store
+	ErrClosed = errors.New("sortedset: store is closed")
+	// ErrKeyTooLong returned on write of key longer than 1 MiB
+	ErrKeyTooLong = errors.New("sortedset: key too long")
+)
+
+// Store is a persistent ordered set of keys in directory.
+// Writes go to write-ahead log and to memtable, SortedSet of keys and
+// SortedSet of deleted keys. Full memtable is flushed to immutable run,
+// a snapshot file with put and delete entries. Reads merge memtable with
+// runs, newer entry win. When there are too many runs, they are merged in
+// background into one and deleted keys are dropped.
+// Live runs are listed in MANIFEST file, other files in directory are removed
+// on open
+type Store struct {
+	mu   sync.RWMutex
+	dir  string
+	opts storeOptions
+	mem  *SortedSet
+	dead *SortedSet
+	wal  *os.File
+	runs []*run // oldest first
+	seq  int
+	err  error // background compaction error
+
+	compactMu sync.Mutex
+	compactc  chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// run is immutable sorted file of store
+type run struct {
+	*MappedSet
+	name string
+}
+
+// StoreOption configure store opened by OpenStore
+type StoreOption func(*storeOptions) error
+
+type storeOptions struct {
+	memtableSize int
+	maxRuns      int
+}
+
+// WithMemtableSize set number of puts and deletes kept in memory before
+// flush to run, default is 65536
+func WithMemtableSize(keys int) StoreOption {
+	return func(o *storeOptions) error {
+		if keys <= 0 {
+			return fmt.Errorf("sortedset: memtable size %d, must be > 0", keys)
+		}
+		o.memtableSize = keys
+		return nil
+	}
+}
+
+// WithMaxRuns set number of runs which start background compaction,
+// default is 4
+func WithMaxRuns(runs int) StoreOption {
+	return func(o *storeOptions) error {
+		if runs <= 0 {
+			return fmt.Errorf("sortedset: max runs %d, must be > 0", runs)
+		}
+		o.maxRuns = runs
+		return nil
+	}
+}
+
+// OpenStore open or create store in dir
+func OpenStore(dir string, opts ...StoreOption) (*Store, error) {
+	o := storeOptions{memtableSize: defaultMemtableSize, maxRuns: defaultMaxRuns}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:      dir,
+		opts:     o,
+		mem:      New(),
+		dead:     New(),
+		compactc: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if err := s.open(); err != nil {
+		for _, r := range s.runs {
+			r.Close()
+		}
+		if s.wal != nil {
+			s.wal.Close()
+		}
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.compactLoop()
+	if len(s.runs) > s.opts.maxRuns {
+		s.compactc <- struct{}{}
+	}
+	return s, nil
+}
+
+// open read manifest, remove unused files and replay log
+func (s *Store) open() error {
+	names := map[string]bool{}
+	manifest, err := os.ReadFile(filepath.Join(s.dir, manifestFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, name := range strings.Fields(string(manifest)) {
+		m, err := openMapped(filepath.Join(s.dir, name), flagKinds)
+		if err != nil {
+			return fmt.Errorf("sortedset: run %s: %w", name, err)
+		}
+		s.runs = append(s.runs, &run{MappedSet: m, name: name})
+		names[name] = true
+		var seq int
+		if _, err := fmt.Sscanf(name, "%06d.run", &seq); err == nil && seq > s.seq {
+			s.seq = seq
+		}
+	}
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if name := f.Name(); !names[name] && strings.Contains(name, ".run") {
+			os.Remove(filepath.Join(s.dir, name))
+		}
+	}
+	return s.replay()
+}
+
+// WAL record: crc32 of the rest uint32, kind byte, uvarint key length, key
+
+// replay apply log to memtable, broken tail of log is truncated
+func (s *Store) replay() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, walFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	s.wal = f
+	r := bufio.NewReader(f)
+	var good int64
+	var head [4]byte
+	for {
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			break
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			break
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > maxKeyLen {
+			break
+		}
+		// length is not checked by crc yet, key is read as it come
+		key, err := readPayload(r, n)
+		if err != nil {
+			break
+		}
+		rec := binary.AppendUvarint([]byte{kind}, n)
+		rec = append(rec, key...)
+		if crc32.ChecksumIEEE(rec) != binary.LittleEndian.Uint32(head[:]) {
+			break
+		}
+		s.apply(kind, string(key))
+		good += int64(4 + len(rec))
+	}
+	if err := f.Truncate(good); err != nil {
+		return err
+	}
+	_, err = f.Seek(good, io.SeekStart)
+	return err
+}
+
+// maxKeyLen is a limit for key length in log and in replication stream
+const maxKeyLen = 1 << 20
+
+// apply change to memtable
+func (s *Store) apply(kind byte, key string) {
+	if kind == kindDel {
+		s.mem.Delete(key)
+		s.dead.Put(key)
+		return
+	}
+	s.dead.Delete(key)
+	s.mem.Put(key)
+}
+
+// write log record and apply it, flush full memtable
+func (s *Store) write(kind byte, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wal == nil {
+		return ErrClosed
+	}
+	if len(key) > maxKeyLen {
+		return ErrKeyTooLong
+	}
+	rec := make([]byte, 4, 4+1+binary.MaxVarintLen64+len(key))
+	rec = append(rec, kind)
+	rec = binary.AppendUvarint(rec, uint64(len(key)))
+	rec = append(rec, key...)
+	binary.LittleEndian.PutUint32(rec, crc32.ChecksumIEEE(rec[4:]))
+	if _, err := s.wal.Write(rec); err != nil {
+		return err
+	}
+	s.apply(kind, key)
+	if s.mem.Len()+s.dead.Len() >= s.opts.memtableSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// Put add key to store. Write is in OS cache when Put return, use Sync
+// to flush it to disk
+func (s *Store) Put(key string) error {
+	return s.write(kindPut, key)
+}
+
+// Delete remove key from store
+func (s *Store) Delete(key string) error {
+	return s.write(kindDel, key)
+}
+
+// Sync flush log to disk
+func (s *Store) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.wal == nil {
+		return ErrClosed
+	}
+	return s.wal.Sync()
+}
+
+// Has return true if key in store
+func (s *Store) Has(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.mem.Has(key) {
+		return true
+	}
+	if s.dead.Has(key) {
+		return false
+	}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		r := s.runs[i]
+		idxPage, idxItem := r.search(func(k string) bool {
+			return k <= key
+		})
+		if k, ok := r.at(idxPage, idxItem); ok && k == key {
+			return !r.deleted(idxPage, idxItem)
+		}
+	}
+	return false
+}
+
+// Range call fn for keys >= from and < to in order, until fn return false.
+// Empty to means no upper bound. Store is locked for writes during Range,
+// fn must not modify store
+func (s *Store) Range(from, to string, order Order, fn func(key string) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	merge(s.sources(from, to, order), order, true, func(key string, deleted bool) bool {
+		return fn(strings.Clone(key))
+	})
+}
+
+// Keys return all keys in descending order
+func (s *Store) Keys() (result []string) {
+	result = []string{}
+	s.Range("", "", Descending, func(key string) bool {
+		result = append(result, key)
+		return true
+	})
+	return result
+}
+
+// sources return cursors over memtable and runs, newest first
+// Memtable is read without its lock, it's changed only under store lock
+func (s *Store) sources(from, to string, order Order) []*rangeCursor {
+	srcs := []*rangeCursor{
+		newRangeCursor(s.mem, nil, kindPut, from, to, order),
+		newRangeCursor(s.dead, nil, kindDel, from, to, order),
+	}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		srcs = append(srcs, newRangeCursor(s.runs[i], s.runs[i].MappedSet, kindPut, from, to, order))
+	}
+	return srcs
+}
+
+// merge call fn for every key of sources in order, entry from the first
+// source with the key win. Deleted keys are skipped if skipDeleted
+func merge(srcs []*rangeCursor, order Order, skipDeleted bool, fn func(key string, deleted bool) bool) {
+	for {
+		best := -1
+		bestKey := ""
+		for i, src := range srcs {
+			if !src.ok {
+				continue
+			}
+			if best < 0 || (order == Ascending && src.key < bestKey) || (order == Descending && src.key > bestKey) {
+				best, bestKey = i, src.key
+			}
+		}
+		if best < 0 {
+			return
+		}
+		deleted := srcs[best].deleted()
+		for _, src := range srcs {
+			if src.ok && src.key == bestKey {
+				src.next()
+			}
+		}
+		if deleted && skipDeleted {
+			continue
+		}
+		if !fn(bestKey, deleted) {
+			return
+		}
+	}
+}
+
+// rangeCursor walk range of SortedSet or MappedSet in order
+type rangeCursor struct {
+	ix      pageIndex
+	run     *MappedSet // nil for memtable
+	kind    byte       // kind of memtable keys
+	to      string
+	from    string
+	order   Order
+	idxPage int
+	idxItem int
+	key     string
+	ok      bool
+}
+
+func newRangeCursor(ix pageIndex, run *MappedSet, kind byte, from, to string, order Order) *rangeCursor {
+	c := &rangeCursor{ix: ix, run: run, kind: kind, from: from, to: to, order: order}
+	c.idxPage, c.idxItem = rangeStart(ix, from, to, order)
+	c.load()
+	return c
+}
+
+func (c *rangeCursor) load() {
+	c.key, c.ok = c.ix.at(c.idxPage, c.idxItem)
+	if c.ok && (c.key < c.from || (c.to != "" && c.key >= c.to)) {
+		c.ok = false
+	}
+}
+
+func (c *rangeCursor) next() {
+	c.idxPage, c.idxItem = c.ix.step(c.idxPage, c.idxItem, c.order)
+	c.load()
+}
+
+func (c *rangeCursor) deleted() bool {
+	if c.run != nil {
+		return c.run.deleted(c.idxPage, c.idxItem)
+	}
+	return c.kind == kindDel
+}
+
+// Flush write memtable to new run
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wal == nil {
+		return ErrClosed
+	}
+	return s.flush()
+}
+
+func (s *Store) flush() error {
+	if s.mem.Len()+s.dead.Len() == 0 {
+		return nil
+	}
+	srcs := []*rangeCursor{
+		newRangeCursor(s.mem, nil, kindPut, "", "", Descending),
+		newRangeCursor(s.dead, nil, kindDel, "", "", Descending),
+	}
+	// deletes are needed only to hide keys in older runs
+	r, err := s.writeRun(s.seq+1, srcs, len(s.runs) == 0)
+	if err != nil {
+		return err
+	}
+	s.seq++
+	runs := append(s.runs[:len(s.runs):len(s.runs)], r)
+	if err := s.writeManifest(runs); err != nil {
+		r.Close()
+		return err
+	}
+	s.runs = runs
+	s.mem = New()
+	s.dead = New()
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if len(s.runs) > s.opts.maxRuns {
+		select {
+		case s.compactc <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// writeRun merge sources into new run file and open it
+func (s *Store) writeRun(seq int, srcs []*rangeCursor, skipDeleted bool) (*run, error) {
+	name := fmt.Sprintf("%06d.run", seq)
+	path := filepath.Join(s.dir, name)
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		sw, err := newSnapshotWriter(w, flagKinds, defaultPageSize)
+		if err != nil {
+			return err
+		}
+		merge(srcs, Descending, skipDeleted, func(key string, deleted bool) bool {
+			kind := byte(kindPut)
+			if deleted {
+				kind = kindDel
+			}
+			err = sw.add(key, kind)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		return sw.close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	m, err := openMapped(path, flagKinds)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return &run{MappedSet: m, name: name}, nil
+}
+
+// writeManifest replace list of live runs
+func (s *Store) writeManifest(runs []*run) error {
+	return writeFileAtomic(filepath.Join(s.dir, manifestFile), func(w io.Writer) error {
+		for _, r := range runs {
+			if _, err := fmt.Fprintln(w, r.name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) compactLoop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.compactc:
+			if err := s.Compact(); err != nil && err != ErrClosed {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Compact merge all runs into one and drop deleted keys.
+// It's done in background when number of runs exceed max runs
+func (s *Store) Compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	if s.wal == nil {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	old := s.runs
+	if len(old) < 2 {
+		s.mu.Unlock()
+		return nil
+	}
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	// runs are immutable and closed only by compaction or Close,
+	// so they are merged without lock
+	srcs := make([]*rangeCursor, 0, len(old))
+	for i := len(old) - 1; i >= 0; i-- {
+		srcs = append(srcs, newRangeCursor(old[i], old[i].MappedSet, kindPut, "", "", Descending))
+	}
+	// the oldest run is merged, deleted keys hide nothing
+	merged, err := s.writeRun(seq, srcs, true)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.wal == nil {
+		s.mu.Unlock()
+		merged.Close()
+		os.Remove(filepath.Join(s.dir, merged.name))
+		return ErrClosed
+	}
+	// runs flushed during compaction are newer than merged
+	runs := append([]*run{merged}, s.runs[len(old):]...)
+	if err := s.writeManifest(runs); err != nil {
+		s.mu.Unlock()
+		merged.Close()
+		os.Remove(filepath.Join(s.dir, merged.name))
+		return err
+	}
+	s.runs = runs
+	s.mu.Unlock()
+
+	for _, r := range old {
+		r.Close()
+		os.Remove(filepath.Join(s.dir, r.name))
+	}
+	return nil
+}
+
+// Runs return number of run files
+func (s *Store) Runs() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.runs)
+}
+
+// Close stop compaction and close files, memtable stay in log.
+// It return background compaction error, if any
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.wal == nil {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	close(s.done)
+	s.mu.Unlock()
+	s.wg.Wait()
+	// wait for Compact called by user
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.wal.Sync()
+	if cerr := s.wal.Close(); err == nil {
+		err = cerr
+	}
+	s.wal = nil
+	for _, r := range s.runs {
+		r.Close()
+	}
+	s.runs = nil
+	if err == nil {
+		err = s.err
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package sortedset
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func storeModel(model map[string]bool, order Order) []string {
+	keys := make([]string, 0, len(model))
+	for key := range model {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if order == Descending {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	return keys
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStore(dir, WithMemtableSize(100), WithMaxRuns(3))
+	assert.NoError(t, err)
+	model := map[string]bool{}
+	keys := randKeys(1000)
+	for i := 0; i < 5000; i++ {
+		key := keys[rand.Intn(len(keys))]
+		if rand.Intn(3) == 0 {
+			assert.NoError(t, s.Delete(key))
+			delete(model, key)
+		} else {
+			assert.NoError(t, s.Put(key))
+			model[key] = true
+		}
+		if i%500 == 0 {
+			assert.Equal(t, storeModel(model, Descending), s.Keys())
+		}
+	}
+	for _, key := range keys {
+		assert.Equal(t, model[key], s.Has(key), key)
+	}
+	assert.Equal(t, storeModel(model, Descending), s.Keys())
+
+	asc := storeModel(model, Ascending)
+	var got []string
+	s.Range(asc[10], asc[20], Ascending, func(key string) bool {
+		got = append(got, key)
+		return true
+	})
+	assert.Equal(t, asc[10:20], got)
+	got = got[:0]
+	s.Range(asc[10], asc[20], Descending, func(key string) bool {
+		got = append(got, key)
+		return len(got) < 3
+	})
+	assert.Equal(t, []string{asc[19], asc[18], asc[17]}, got)
+
+	assert.NoError(t, s.Compact())
+	assert.Equal(t, 1, s.Runs())
+	assert.Equal(t, storeModel(model, Descending), s.Keys())
+	assert.NoError(t, s.Close())
+	assert.Equal(t, ErrClosed, s.Put("a"))
+	assert.Equal(t, ErrClosed, s.Close())
+
+	s, err = OpenStore(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, storeModel(model, Descending), s.Keys())
+	for _, key := range keys {
+		assert.Equal(t, model[key], s.Has(key), key)
+	}
+}
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStore(dir, WithMemtableSize(4))
+	assert.NoError(t, err)
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		assert.NoError(t, s.Put(key))
+	}
+	assert.NoError(t, s.Delete("b"))
+	assert.NoError(t, s.Delete("f"))
+	assert.Equal(t, 1, s.Runs())
+	assert.NoError(t, s.Close())
+
+	// torn write at the end of log and run file not in manifest
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, err = wal.Write([]byte{1, 2, 3, 4, kindPut, 10, 'x'})
+	assert.NoError(t, err)
+	assert.NoError(t, wal.Close())
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "000042.run"), []byte("junk"), 0o644))
+
+	s, err = OpenStore(dir, WithMemtableSize(4))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e", "d", "c", "a"}, s.Keys())
+	assert.False(t, s.Has("b"))
+	assert.False(t, s.Has("f"))
+	_, err = os.Stat(filepath.Join(dir, "000042.run"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, s.Put("g"))
+	assert.NoError(t, s.Close())
+
+	s, err = OpenStore(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"g", "e", "d", "c", "a"}, s.Keys())
+	assert.NoError(t, s.Close())
+
+	_, err = OpenStore(dir, WithMaxRuns(0))
+	assert.Error(t, err)
+
+	// garbage length in log is not allocated before key come
+	s, err = OpenStore(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrKeyTooLong, s.Put(strings.Repeat("x", maxKeyLen+1)))
+	assert.NoError(t, s.Close())
+	for _, n := range []uint64{maxKeyLen, maxKeyLen + 1, 1 << 62} {
+		wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0)
+		assert.NoError(t, err)
+		_, err = wal.Write(append(binary.AppendUvarint([]byte{1, 2, 3, 4, kindPut}, n), make([]byte, 1000)...))
+		assert.NoError(t, err)
+		assert.NoError(t, wal.Close())
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		s, err = OpenStore(dir)
+		runtime.ReadMemStats(&after)
+		assert.NoError(t, err)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(maxKeyLen/2))
+		assert.Equal(t, []string{"g", "e", "d", "c", "a"}, s.Keys())
+		assert.NoError(t, s.Close())
+	}
+
+	// damaged run fail open
+	manifest, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	assert.NoError(t, err)
+	run := filepath.Join(dir, strings.Fields(string(manifest))[0])
+	data, err := os.ReadFile(run)
+	assert.NoError(t, err)
+	binary.LittleEndian.PutUint32(data[headerSize+4+4:], 1<<30)
+	assert.NoError(t, os.WriteFile(run, data, 0o644))
+	_, err = OpenStore(dir)
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestStoreBackgroundCompaction(t *testing.T) {
+	s, err := OpenStore(t.TempDir(), WithMemtableSize(10), WithMaxRuns(2))
+	assert.NoError(t, err)
+	keys := randKeys(2000)
+	for _, key := range keys {
+		assert.NoError(t, s.Put(key))
+	}
+	for _, key := range keys[:1000] {
+		assert.NoError(t, s.Delete(key))
+	}
+	for i := 0; i < 100 && s.Runs() > 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, s.Runs() <= 3, "runs %d", s.Runs())
+	sort.Sort(sort.Reverse(sort.StringSlice(keys[1000:])))
+	assert.Equal(t, keys[1000:], s.Keys())
+	assert.NoError(t, s.Close())
+}
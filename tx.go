@@ -0,0 +1,279 @@
+package sortedset
+
+import "errors"
+
+var (
+	// ErrTxReadOnly returned on write in View transaction
+	ErrTxReadOnly = errors.New("sortedset: transaction is read-only")
+	// ErrTxClosed returned on use of transaction after Update or View return
+	ErrTxClosed = errors.New("sortedset: transaction is closed")
+	// ErrTxConflict returned by Update if keys read in transaction were
+	// changed outside of it, changes are dropped and Update may be retried
+	ErrTxConflict = errors.New("sortedset: transaction conflict")
+)
+
+// Tx is a transaction, see Update and View.
+// Tx must be used only in one goroutine and only inside Update or View
+type Tx struct {
+	set      *SortedSet
+	snap     *SortedSet // clone of set at start, transaction read it
+	puts     *SortedSet // writes of Update, nil until first write
+	dels     *SortedSet
+	reads    []KeyRange // ranges of snap read by Update
+	writable bool
+	closed   bool
+}
+
+// Update run fn in writable transaction. Transaction read state of set at
+// its start and its own changes, they are invisible to other readers until
+// commit. If fn return error, all changes are dropped and error is returned.
+// Update transactions are serialized, Put and Delete outside of transaction
+// are not blocked. If they changed keys read by transaction before commit,
+// changes are dropped and ErrTxConflict is returned
+func (set *SortedSet) Update(fn func(tx *Tx) error) error {
+	set.txMu.Lock()
+	defer set.txMu.Unlock()
+	tx := &Tx{set: set, snap: set.Clone(), writable: true}
+	err := fn(tx)
+	tx.closed = true
+	if err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// commit check keys read by transaction and apply its writes at once,
+// they are observed like Put and Delete
+func (tx *Tx) commit() error {
+	if tx.puts == nil {
+		return nil
+	}
+	set := tx.set
+	start := set.lock(OpPut)
+	for _, r := range tx.reads {
+		// summary is count and hash of keys, equal if range is not changed
+		if set.summary(r.From, r.To) != tx.snap.summary(r.From, r.To) {
+			set.unlockWrites(start, 0, 0)
+			return ErrTxConflict
+		}
+	}
+	dels := tx.dels.Keys()
+	for _, key := range dels {
+		set.delete(key)
+	}
+	puts := tx.puts.Keys()
+	for _, key := range puts {
+		set.put(key)
+	}
+	set.unlockWrites(start, len(puts), len(dels))
+	return nil
+}
+
+// View run fn in read-only transaction on state of set at its start.
+// Set is not locked during fn
+func (set *SortedSet) View(fn func(tx *Tx) error) error {
+	tx := &Tx{set: set, snap: set.Clone()}
+	err := fn(tx)
+	tx.closed = true
+	return err
+}
+
+// read remember range of snap read by Update
+func (tx *Tx) read(from, to string) {
+	if tx.writable {
+		tx.reads = append(tx.reads, KeyRange{From: from, To: to})
+	}
+}
+
+// rangeKeys call fn for keys >= from and < to in order, writes are merged
+// with snap like memtable in Store
+func (tx *Tx) rangeKeys(from, to string, order Order, fn func(key string) bool) {
+	var srcs []*rangeCursor
+	if tx.puts != nil {
+		srcs = append(srcs,
+			newRangeCursor(tx.puts, nil, kindPut, from, to, order),
+			newRangeCursor(tx.dels, nil, kindDel, from, to, order))
+	}
+	srcs = append(srcs, newRangeCursor(tx.snap, nil, kindPut, from, to, order))
+	// keys up to the last one passed to fn are read
+	read := KeyRange{From: from, To: to}
+	merge(srcs, order, true, func(key string, deleted bool) bool {
+		if fn(key) {
+			return true
+		}
+		if order == Ascending {
+			read.To = key + "\x00"
+		} else {
+			read.From = key
+		}
+		return false
+	})
+	tx.read(read.From, read.To)
+}
+
+// Writable return true for Update transaction
+func (tx *Tx) Writable() bool {
+	return tx.writable
+}
+
+func (tx *Tx) write(key string, delete bool) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	if !tx.writable {
+		return ErrTxReadOnly
+	}
+	if tx.puts == nil {
+		tx.puts, tx.dels = New(), New()
+	}
+	if delete {
+		tx.puts.Delete(key)
+		tx.dels.Put(key)
+	} else {
+		tx.dels.Delete(key)
+		tx.puts.Put(key)
+	}
+	return nil
+}
+
+// Put add key to set
+func (tx *Tx) Put(key string) error {
+	return tx.write(key, false)
+}
+
+// Delete remove key from set
+func (tx *Tx) Delete(key string) error {
+	return tx.write(key, true)
+}
+
+// Has return true if key in set
+func (tx *Tx) Has(key string) bool {
+	if tx.closed {
+		return false
+	}
+	if tx.puts != nil {
+		if tx.dels.Has(key) {
+			return false
+		}
+		if tx.puts.Has(key) {
+			return true
+		}
+	}
+	tx.read(key, key+"\x00")
+	return tx.snap.has(key)
+}
+
+// Bucket return bucket in transaction
+func (tx *Tx) Bucket(name string) *TxBucket {
+	return &TxBucket{tx: tx, Name: name}
+}
+
+// TxBucket is a bucket in transaction
+type TxBucket struct {
+	Name string
+	tx   *Tx
+}
+
+// Put add key to bucket
+func (bkt *TxBucket) Put(key string) error {
+	return bkt.tx.Put(bkt.Name + key)
+}
+
+// Delete remove key from bucket
+func (bkt *TxBucket) Delete(key string) error {
+	return bkt.tx.Delete(bkt.Name + key)
+}
+
+// Has return true if key in bucket
+func (bkt *TxBucket) Has(key string) bool {
+	return bkt.tx.Has(bkt.Name + key)
+}
+
+// Keys return keys from bucket, see BucketStore.Keys
+func (bkt *TxBucket) Keys(limit, offset int) (result []string) {
+	if bkt.tx.closed {
+		return nil
+	}
+	bkt.tx.rangeKeys(bkt.Name, PrefixEnd(bkt.Name), bkt.tx.set.opts.order, func(key string) bool {
+		if offset > 0 {
+			offset--
+			return true
+		}
+		if limit > 0 && len(result) == limit {
+			return false
+		}
+		result = append(result, key[len(bkt.Name):])
+		return true
+	})
+	return result
+}
+
+// Cursor return cursor over bucket keys, it's not positioned until
+// First, Last or Seek. Cursor keep only current key, like MultiCursor,
+// so it's valid after changes in transaction
+func (bkt *TxBucket) Cursor() *TxCursor {
+	return &TxCursor{tx: bkt.tx, prefix: bkt.Name}
+}
+
+// TxCursor iterate over bucket keys in both directions.
+// First is the smallest key, Next move to greater key
+type TxCursor struct {
+	tx     *Tx
+	prefix string
+	key    string
+	ok     bool
+}
+
+// move to the first key of range in order, range is without prefix
+func (c *TxCursor) move(from, to string, order Order) bool {
+	c.key, c.ok = "", false
+	if c.tx.closed {
+		return false
+	}
+	end := PrefixEnd(c.prefix)
+	if to != "" {
+		end = c.prefix + to
+	}
+	c.tx.rangeKeys(c.prefix+from, end, order, func(key string) bool {
+		c.key, c.ok = key[len(c.prefix):], true
+		return false
+	})
+	return c.ok
+}
+
+// First move to the smallest key, false if bucket is empty
+func (c *TxCursor) First() bool {
+	return c.move("", "", Ascending)
+}
+
+// Last move to the greatest key, false if bucket is empty
+func (c *TxCursor) Last() bool {
+	return c.move("", "", Descending)
+}
+
+// Seek move to the first key >= key, false if there is no such key
+func (c *TxCursor) Seek(key string) bool {
+	return c.move(key, "", Ascending)
+}
+
+// Next move to the next greater key, false at the end
+func (c *TxCursor) Next() bool {
+	if !c.ok {
+		return false
+	}
+	return c.move(c.key+"\x00", "", Ascending)
+}
+
+// Prev move to the next smaller key, false at the end
+func (c *TxCursor) Prev() bool {
+	if !c.ok || c.key == "" {
+		c.key, c.ok = "", false
+		return false
+	}
+	return c.move("", c.key, Descending)
+}
+
+// Key return key at cursor without bucket name
+func (c *TxCursor) Key() string {
+	return c.key
+}
@@ -0,0 +1,243 @@
+package sortedset
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	set := New(WithPageSize(4))
+	pending := Bucket(set, "pending:")
+	for _, key := range []string{"1", "2", "3"} {
+		pending.Put(key)
+	}
+
+	// move key between buckets
+	err := set.Update(func(tx *Tx) error {
+		assert.True(t, tx.Writable())
+		assert.NoError(t, tx.Bucket("pending:").Delete("2"))
+		assert.NoError(t, tx.Bucket("done:").Put("2"))
+		assert.True(t, tx.Bucket("done:").Has("2"))
+		assert.False(t, tx.Bucket("pending:").Has("2"))
+		// invisible outside until commit
+		assert.True(t, set.Has("pending:2"))
+		assert.False(t, set.Has("done:2"))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pending:3", "pending:1", "done:2"}, set.Keys())
+
+	// rollback
+	fail := errors.New("fail")
+	var saved *Tx
+	err = set.Update(func(tx *Tx) error {
+		saved = tx
+		tx.Bucket("pending:").Delete("1")
+		tx.Bucket("pending:").Delete("3")
+		tx.Put("x")
+		return fail
+	})
+	assert.Equal(t, fail, err)
+	assert.Equal(t, []string{"pending:3", "pending:1", "done:2"}, set.Keys())
+	assert.NoError(t, set.Validate())
+	assert.Equal(t, ErrTxClosed, saved.Put("y"))
+	assert.False(t, saved.Has("pending:1"))
+
+	err = set.View(func(tx *Tx) error {
+		assert.False(t, tx.Writable())
+		assert.Equal(t, ErrTxReadOnly, tx.Put("x"))
+		assert.Equal(t, ErrTxReadOnly, tx.Bucket("done:").Delete("2"))
+		assert.Equal(t, []string{"3", "1"}, tx.Bucket("pending:").Keys(0, 0))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTxCursor(t *testing.T) {
+	set := New(WithPageSize(4))
+	for i := 0; i < 20; i++ {
+		set.Put(fmt.Sprintf("a%02d", i))
+		set.Put(fmt.Sprintf("b%02d", i))
+	}
+	set.Put("b\xff")
+	set.Update(func(tx *Tx) error {
+		bkt := tx.Bucket("a")
+		bkt.Delete("05")
+		bkt.Put("99")
+		var keys []string
+		c := bkt.Cursor()
+		for ok := c.First(); ok; ok = c.Next() {
+			keys = append(keys, c.Key())
+		}
+		assert.Equal(t, 20, len(keys))
+		assert.Equal(t, "00", keys[0])
+		assert.Equal(t, "99", keys[19])
+		assert.True(t, c.Last())
+		assert.Equal(t, "99", c.Key())
+		assert.True(t, c.Prev())
+		assert.Equal(t, "19", c.Key())
+		assert.True(t, c.Seek("05"))
+		assert.Equal(t, "06", c.Key())
+		assert.False(t, c.Seek("999"))
+
+		c = tx.Bucket("b").Cursor()
+		assert.True(t, c.Last())
+		assert.Equal(t, "\xff", c.Key())
+		assert.False(t, tx.Bucket("c").Cursor().First())
+		assert.False(t, tx.Bucket("c").Cursor().Last())
+		return nil
+	})
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	set := New()
+	counter := Bucket(set, "n:")
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				set.Update(func(tx *Tx) error {
+					// take the largest number and put the next one
+					c := tx.Bucket("n:").Cursor()
+					n := 0
+					if c.Last() {
+						fmt.Sscanf(c.Key(), "%06d", &n)
+					}
+					return tx.Bucket("n:").Put(fmt.Sprintf("%06d", n+1))
+				})
+				set.View(func(tx *Tx) error {
+					tx.Bucket("n:").Keys(1, 0)
+					return nil
+				})
+				set.Put(fmt.Sprintf("other:%d:%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 400, len(counter.Keys(0, 0)))
+	assert.NoError(t, set.Validate())
+}
+
+func TestTxOverlay(t *testing.T) {
+	set := New(WithPageSize(4))
+	for i := 0; i < 20; i++ {
+		set.Put(fmt.Sprintf("k%02d", i))
+	}
+	err := set.Update(func(tx *Tx) error {
+		bkt := tx.Bucket("k")
+		assert.NoError(t, bkt.Delete("05"))
+		assert.NoError(t, bkt.Put("05"))
+		assert.NoError(t, bkt.Delete("06"))
+		assert.NoError(t, bkt.Put("50"))
+		assert.NoError(t, tx.Delete("k07"))
+		assert.NoError(t, tx.Delete("nope"))
+		// not blocked, keys not read by transaction may be changed
+		set.Put("x40")
+		assert.True(t, bkt.Has("05"))
+		assert.False(t, bkt.Has("07"))
+		assert.Equal(t, []string{"50", "19", "18"}, bkt.Keys(3, 0))
+		assert.Equal(t, []string{"08", "05", "04"}, bkt.Keys(3, 12))
+		c := bkt.Cursor()
+		assert.True(t, c.Seek("06"))
+		assert.Equal(t, "08", c.Key())
+		assert.True(t, c.Prev())
+		assert.Equal(t, "05", c.Key())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 20, set.Len())
+	assert.True(t, set.Has("k05"))
+	assert.False(t, set.Has("k06"))
+	assert.False(t, set.Has("k07"))
+	assert.True(t, set.Has("k50"))
+	assert.NoError(t, set.Validate())
+
+	// set may be used in View
+	err = set.View(func(tx *Tx) error {
+		set.Put("x41")
+		assert.True(t, set.Has("x41"))
+		assert.False(t, tx.Has("x41"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTxConflict(t *testing.T) {
+	set := New(WithPageSize(4))
+	for i := 0; i < 20; i++ {
+		set.Put(fmt.Sprintf("pending:%02d", i))
+	}
+	// move key if it's still there
+	move := func(key string, outside func()) error {
+		return set.Update(func(tx *Tx) error {
+			if !tx.Bucket("pending:").Has(key) {
+				return nil
+			}
+			outside()
+			tx.Bucket("pending:").Delete(key)
+			return tx.Bucket("done:").Put(key)
+		})
+	}
+	assert.Equal(t, ErrTxConflict, move("01", func() { set.Delete("pending:01") }))
+	assert.False(t, set.Has("done:01"))
+	// other keys may be changed
+	assert.NoError(t, move("02", func() {
+		set.Delete("pending:03")
+		set.Put("done:03")
+	}))
+	assert.True(t, set.Has("done:02"))
+	assert.False(t, set.Has("pending:02"))
+
+	// ranges read by cursor and Keys are checked too
+	take := func(outside func()) error {
+		return set.Update(func(tx *Tx) error {
+			c := tx.Bucket("pending:").Cursor()
+			if !c.First() {
+				return nil
+			}
+			outside()
+			tx.Bucket("pending:").Delete(c.Key())
+			return tx.Bucket("done:").Put(c.Key())
+		})
+	}
+	assert.Equal(t, ErrTxConflict, take(func() { set.Put("pending:") }))
+	set.Delete("pending:")
+	assert.NoError(t, take(func() { set.Put("pending:99") }))
+	assert.True(t, set.Has("done:00"))
+	err := set.Update(func(tx *Tx) error {
+		// read the greatest keys, change key below them
+		keys := tx.Bucket("pending:").Keys(2, 0)
+		set.Delete("pending:05")
+		return tx.Put("count:" + fmt.Sprint(len(keys)))
+	})
+	assert.NoError(t, err)
+	err = set.Update(func(tx *Tx) error {
+		keys := tx.Bucket("pending:").Keys(2, 0)
+		set.Put("pending:98")
+		return tx.Put("count:" + fmt.Sprint(len(keys)))
+	})
+	assert.Equal(t, ErrTxConflict, err)
+	assert.NoError(t, set.Validate())
+}
+
+func TestTxObserver(t *testing.T) {
+	o := &countObserver{names: map[string]bool{}, ops: map[Op]int{}}
+	set := New()
+	set.Instrument("tx", o)
+	set.Put("a")
+	err := set.Update(func(tx *Tx) error {
+		tx.Put("b")
+		tx.Put("c")
+		return tx.Delete("a")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, o.ops[OpPut])
+	assert.Equal(t, 1, o.ops[OpDelete])
+	assert.Equal(t, 2, o.size)
+}